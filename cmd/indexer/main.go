@@ -2,40 +2,123 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
 	"syscall"
 	"time"
 
-	elasticclient "github.com/elastic/go-elasticsearch/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/sync/errgroup"
 
 	esadapter "github.com/nimafallahian/go-workflow/internal/adapters/es"
 	kafkaadapter "github.com/nimafallahian/go-workflow/internal/adapters/kafka"
+	metricsadapter "github.com/nimafallahian/go-workflow/internal/adapters/metrics"
 	"github.com/nimafallahian/go-workflow/internal/config"
+	"github.com/nimafallahian/go-workflow/internal/httpapi"
+	"github.com/nimafallahian/go-workflow/internal/ports"
 	"github.com/nimafallahian/go-workflow/internal/service"
 )
 
+// readinessTimeout bounds the dependency checks behind /readyz so that the
+// endpoint answers within the Kubernetes probe timeout.
+const readinessTimeout = 1500 * time.Millisecond
+
+// offsetMetadataKey is the metadata entry holding the Kafka offset of each
+// indexed event when it is used as the external document version and
+// KAFKA_METADATA_PREFIX is unset. It is not stored with the document.
+const offsetMetadataKey = "kafka.offset"
+
+// timestampMetadataKey is the metadata entry holding the Kafka timestamp of
+// each indexed event when ELASTIC_TIMESTAMP_FIELD names it and
+// KAFKA_METADATA_PREFIX does not add it. It is not stored with the document.
+const timestampMetadataKey = "kafka.timestamp"
+
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{}))
+	// The level starts at INFO and is replaced by LOG_LEVEL once the config
+	// has loaded; it can be changed at runtime via /admin/log-level.
+	var level slog.LevelVar
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: &level}))
 	slog.SetDefault(logger)
 
-	cfg, err := config.Load()
+	var err error
+	switch args := os.Args[1:]; {
+	case len(args) == 0:
+		err = run(logger, &level)
+	case len(args) == 1 && args[0] == "replay":
+		err = replay(logger, &level)
+	default:
+		err = fmt.Errorf("unknown arguments %q; usage: indexer [replay]", args)
+	}
 	if err != nil {
-		logger.Error("failed to load config", "error", err)
+		logger.Error("service terminated with error", "error", err)
 		os.Exit(1)
 	}
+}
+
+// run wires the service from config and blocks until shutdown. It returns an
+// error if startup fails or a component terminates abnormally, so that
+// deferred cleanup runs before the process exits non-zero.
+func run(logger *slog.Logger, level *slog.LevelVar) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return fmt.Errorf("parse log level: %w", err)
+	}
 
 	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	kConsumer, err := kafkaadapter.NewConsumer(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaGroupID)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	pipelineMetrics, err := metricsadapter.NewPrometheus(registry)
 	if err != nil {
-		logger.Error("failed to create kafka consumer", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("register metrics: %w", err)
+	}
+
+	if !cfg.KafkaReplayFrom.IsZero() || cfg.KafkaReplayPartitionOffsets != nil {
+		logger.Warn("KAFKA_REPLAY_FROM and KAFKA_REPLAY_OFFSETS are ignored; run the replay command to apply them")
+	}
+
+	kafkaSecurity, err := newKafkaSecurity(cfg)
+	if err != nil {
+		return err
+	}
+
+	consumerOpts := []kafkaadapter.Option{
+		kafkaadapter.WithSecurity(kafkaSecurity),
+		kafkaadapter.WithMetrics(pipelineMetrics),
+		kafkaadapter.WithLogger(logger),
+		kafkaadapter.WithMinBytes(cfg.KafkaMinBytes),
+		kafkaadapter.WithMaxBytes(cfg.KafkaMaxBytes),
+		kafkaadapter.WithMaxWait(cfg.KafkaMaxWait),
+		kafkaadapter.WithSessionTimeout(cfg.KafkaSessionTimeout),
+		kafkaadapter.WithHeartbeatInterval(cfg.KafkaHeartbeatInterval),
+		kafkaadapter.WithRebalanceTimeout(cfg.KafkaRebalanceTimeout),
+		kafkaadapter.WithIsolationLevel(kafkaadapter.IsolationLevel(cfg.KafkaIsolationLevel)),
+		kafkaadapter.WithStartOffset(kafkaadapter.StartOffset(cfg.KafkaStartOffset)),
+	}
+	if cfg.KafkaStatusHeader != "" {
+		consumerOpts = append(consumerOpts, kafkaadapter.WithStatusHeader(
+			cfg.KafkaStatusHeader, kafkaadapter.StatusPrecedence(cfg.KafkaStatusPrecedence)))
+	}
+
+	subscription, err := newSubscription(cfg)
+	if err != nil {
+		return err
+	}
+
+	kConsumer, err := kafkaadapter.NewConsumer(cfg.KafkaBrokers, subscription, cfg.KafkaGroupID, consumerOpts...)
+	if err != nil {
+		return fmt.Errorf("create kafka consumer: %w", err)
 	}
 	defer func() {
 		if cerr := kConsumer.Close(); cerr != nil {
@@ -43,64 +126,191 @@ func main() {
 		}
 	}()
 
-	esClient, err := elasticclient.NewClient(elasticclient.Config{
-		Addresses: cfg.ElasticURLs,
+	dlqProducer, err := kafkaadapter.NewDeadLetterProducer(cfg.KafkaBrokers, cfg.KafkaDLQTopic,
+		kafkaadapter.WithDeadLetterSecurity(kafkaSecurity),
+		kafkaadapter.WithDeadLetterLogger(logger),
+	)
+	if err != nil {
+		return fmt.Errorf("create kafka dlq producer: %w", err)
+	}
+	defer func() {
+		if cerr := dlqProducer.Close(); cerr != nil {
+			logger.Error("failed to close kafka dlq producer", "error", cerr)
+		}
+	}()
+
+	esClient, err := esadapter.NewClient(esadapter.ClientConfig{
+		Addresses:              cfg.ElasticURLs,
+		CloudID:                cfg.ElasticCloudID,
+		Username:               cfg.ElasticUsername,
+		Password:               cfg.ElasticPassword,
+		APIKey:                 cfg.ElasticAPIKey,
+		CACertFile:             cfg.ElasticCACertFile,
+		CertificateFingerprint: cfg.ElasticCertificateFingerprint,
 	})
 	if err != nil {
-		logger.Error("failed to create elasticsearch client", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("create elasticsearch client: %w", err)
+	}
+
+	indexerOpts := []esadapter.Option{
+		esadapter.WithMetrics(pipelineMetrics),
+		esadapter.WithLogger(logger),
+		esadapter.WithRefresh(esadapter.Refresh(cfg.ElasticRefresh)),
 	}
 
-	indexer, err := esadapter.NewIndexer(esClient, cfg.ElasticIndex)
+	serviceOpts := []service.Option{
+		service.WithDeadLetterPublisher(dlqProducer),
+		service.WithWorkerCount(cfg.WorkerCount),
+		service.WithRetryPolicy(service.RetryPolicy{
+			MaxAttempts: cfg.RetryMaxAttempts,
+			BaseDelay:   cfg.RetryBaseDelay,
+			Multiplier:  cfg.RetryMultiplier,
+			Jitter:      cfg.RetryJitter,
+			MaxDelay:    cfg.RetryMaxDelay,
+		}),
+		service.WithBatchSize(cfg.BatchMaxSize),
+		service.WithBatchBytes(cfg.BatchMaxBytes),
+		service.WithBatchLinger(cfg.BatchLinger),
+		service.WithDispatchMode(service.DispatchMode(cfg.DispatchMode)),
+		service.WithMetrics(pipelineMetrics),
+		service.WithLogger(logger),
+	}
+
+	if cfg.KafkaMetadataPrefix != "" {
+		serviceOpts = append(serviceOpts, service.WithRecordMetadata(cfg.KafkaMetadataPrefix))
+	}
+
+	if cfg.ElasticDataStream {
+		if cfg.ElasticTimestampField == timestampMetadataKey && cfg.KafkaMetadataPrefix+"timestamp" != timestampMetadataKey {
+			serviceOpts = append(serviceOpts, service.WithTimestampMetadata(timestampMetadataKey))
+			indexerOpts = append(indexerOpts, esadapter.WithTransientMetadata(timestampMetadataKey))
+		}
+		indexerOpts = append(indexerOpts, esadapter.WithDataStream(cfg.ElasticTimestampField))
+	}
+
+	if cfg.ElasticVersionType != "" {
+		source := cfg.ElasticVersionSource
+		switch {
+		case source != "offset":
+		case cfg.KafkaMetadataPrefix != "":
+			source = "metadata." + cfg.KafkaMetadataPrefix + "offset"
+		default:
+			source = "metadata." + offsetMetadataKey
+			serviceOpts = append(serviceOpts, service.WithOffsetMetadata(offsetMetadataKey))
+			indexerOpts = append(indexerOpts, esadapter.WithTransientMetadata(offsetMetadataKey))
+		}
+		indexerOpts = append(indexerOpts,
+			esadapter.WithExternalVersion(esadapter.VersionType(cfg.ElasticVersionType), source))
+	}
+
+	indexer, err := esadapter.NewIndexer(esClient, cfg.ElasticIndex, indexerOpts...)
 	if err != nil {
-		logger.Error("failed to create elasticsearch indexer", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("create elasticsearch indexer: %w", err)
+	}
+
+	if cfg.ElasticTemplateBootstrap {
+		err := indexer.Bootstrap(rootCtx, esadapter.BootstrapConfig{
+			Name:           cfg.ElasticTemplateName,
+			PayloadMapping: cfg.ElasticPayloadMapping,
+			Strict:         cfg.ElasticMappingDrift == "fail",
+		})
+		if err != nil {
+			return fmt.Errorf("bootstrap elasticsearch templates: %w", err)
+		}
 	}
 
-	svc := service.NewIndexerService(kConsumer, indexer, cfg.WorkerCount)
+	svc := service.NewIndexerService(kConsumer, indexer, serviceOpts...)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+	mux.Handle("/livez", httpapi.Liveness())
+	mux.Handle("/health", httpapi.Liveness()) // kept for existing probes
+	mux.Handle("/readyz", httpapi.Readiness(map[string]ports.HealthChecker{
+		"kafka":         kConsumer,
+		"elasticsearch": indexer,
+	}, readinessTimeout))
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 
 	httpServer := &http.Server{
 		Addr:         ":8080",
 		Handler:      mux,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 5 * time.Second,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	// The admin endpoints mutate the running process without authentication,
+	// so they are served apart from the probes and metrics, on ADMIN_ADDR.
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/admin/log-level", httpapi.LogLevel(level, logger))
+
+	adminServer := &http.Server{
+		Addr:         cfg.AdminAddr,
+		Handler:      adminMux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}
 
 	g, ctx := errgroup.WithContext(rootCtx)
 
 	// Worker/service loop.
+	// A fatal consumer error cancels ctx and shuts the whole process down.
 	g.Go(func() error {
-		svc.Start(ctx)
-		return nil
+		return svc.Start(ctx)
 	})
 
-	// HTTP health server.
-	g.Go(func() error {
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			return err
-		}
-		return nil
-	})
-
-	// Graceful shutdown for HTTP server on context cancellation.
-	g.Go(func() error {
-		<-ctx.Done()
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			logger.Error("http server shutdown error", "error", err)
-		}
-		return nil
-	})
+	// HTTP probe and metrics server, and the admin server.
+	for _, srv := range []*http.Server{httpServer, adminServer} {
+		g.Go(func() error {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		})
 
-	if err := g.Wait(); err != nil {
-		log.Printf("service terminated with error: %v", err)
+		// Graceful shutdown for the server on context cancellation.
+		g.Go(func() error {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				logger.Error("http server shutdown error", "addr", srv.Addr, "error", err)
+			}
+			return nil
+		})
 	}
+
+	return g.Wait()
 }
 
+// newKafkaSecurity builds the TLS and SASL settings shared by the consumer
+// and the DLQ producer.
+func newKafkaSecurity(cfg *config.Config) (kafkaadapter.Security, error) {
+	sec, err := kafkaadapter.NewSecurity(kafkaadapter.SecurityConfig{
+		TLSEnabled:            cfg.KafkaTLSEnabled,
+		TLSCAFile:             cfg.KafkaTLSCAFile,
+		TLSCertFile:           cfg.KafkaTLSCertFile,
+		TLSKeyFile:            cfg.KafkaTLSKeyFile,
+		TLSInsecureSkipVerify: cfg.KafkaTLSInsecureSkipVerify,
+		SASLMechanism:         cfg.KafkaSASLMechanism,
+		SASLUsername:          cfg.KafkaSASLUsername,
+		SASLPassword:          cfg.KafkaSASLPassword,
+	})
+	if err != nil {
+		return kafkaadapter.Security{}, fmt.Errorf("configure kafka security: %w", err)
+	}
+	return sec, nil
+}
 
+// newSubscription selects the consumed topics: KAFKA_TOPIC_PATTERN if set,
+// KAFKA_TOPIC otherwise.
+func newSubscription(cfg *config.Config) (kafkaadapter.Subscription, error) {
+	if cfg.KafkaTopicPattern == "" {
+		return kafkaadapter.Topics(cfg.KafkaTopics...), nil
+	}
+	pattern, err := regexp.Compile(cfg.KafkaTopicPattern)
+	if err != nil {
+		return kafkaadapter.Subscription{}, fmt.Errorf("compile kafka topic pattern: %w", err)
+	}
+	return kafkaadapter.TopicPattern(pattern, cfg.KafkaTopicRefreshInterval), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"syscall"
+
+	kafkaadapter "github.com/nimafallahian/go-workflow/internal/adapters/kafka"
+	"github.com/nimafallahian/go-workflow/internal/config"
+)
+
+// replay rewinds the consumer group to KAFKA_REPLAY_FROM or
+// KAFKA_REPLAY_OFFSETS and exits. It runs as a one-off job while the indexer
+// is scaled down, since offsets can only be reset for an empty group.
+func replay(logger *slog.Logger, level *slog.LevelVar) error {
+	cfg, err := config.LoadReplay()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return fmt.Errorf("parse log level: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	kafkaSecurity, err := newKafkaSecurity(cfg)
+	if err != nil {
+		return err
+	}
+	subscription, err := newSubscription(cfg)
+	if err != nil {
+		return err
+	}
+
+	kConsumer, err := kafkaadapter.NewConsumer(cfg.KafkaBrokers, subscription, cfg.KafkaGroupID,
+		kafkaadapter.WithSecurity(kafkaSecurity),
+		kafkaadapter.WithLogger(logger),
+	)
+	if err != nil {
+		return fmt.Errorf("create kafka consumer: %w", err)
+	}
+	defer func() {
+		if cerr := kConsumer.Close(); cerr != nil {
+			logger.Error("failed to close kafka consumer", "error", cerr)
+		}
+	}()
+
+	err = kConsumer.Replay(ctx, kafkaadapter.Replay{
+		From:    cfg.KafkaReplayFrom,
+		Offsets: cfg.KafkaReplayPartitionOffsets,
+	})
+	if err != nil {
+		return fmt.Errorf("replay consumer group %q: %w", cfg.KafkaGroupID, err)
+	}
+	logger.Info("consumer group rewound; scale the indexer back up to replay", "group", cfg.KafkaGroupID)
+	return nil
+}
@@ -0,0 +1,250 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// templateFiles holds the component and index templates installed by
+// Bootstrap. The dynamic parts (index patterns, composition, data stream and
+// payload mapping) are filled in at startup.
+//
+//go:embed templates/*.json
+var templateFiles embed.FS
+
+// ErrMappingDrift is returned by Bootstrap in strict mode when an existing
+// index's mapping differs from the installed template.
+var ErrMappingDrift = errors.New("elasticsearch: live mapping drifted from template")
+
+// Payload mappings selectable for the payload field.
+const (
+	// PayloadFlattened indexes the whole payload as a single flattened field,
+	// keeping the mapping bounded whatever producers send.
+	PayloadFlattened = "flattened"
+	// PayloadObject maps payload fields dynamically as they appear.
+	PayloadObject = "object"
+	// PayloadDisabled stores the payload in _source without indexing it.
+	PayloadDisabled = "disabled"
+)
+
+var payloadMappings = map[string]map[string]any{
+	PayloadFlattened: {"type": "flattened"},
+	PayloadObject:    {"type": "object", "dynamic": true},
+	PayloadDisabled:  {"type": "object", "enabled": false},
+}
+
+// BootstrapConfig controls the templates installed by Bootstrap.
+type BootstrapConfig struct {
+	// Name names the composable index template; its component templates are
+	// named Name-settings and Name-mappings.
+	Name string
+
+	// PayloadMapping is PayloadFlattened, PayloadObject or PayloadDisabled.
+	PayloadMapping string
+
+	// Strict makes Bootstrap fail with ErrMappingDrift, rather than log a
+	// warning, when an existing index does not match the template mapping.
+	Strict bool
+}
+
+// Bootstrap installs the component templates and the composable index
+// template covering every index the indexer writes to, then compares the
+// mapping of existing indices against it. Installing is idempotent; a template
+// only applies to indices created afterwards, which is why drift is checked.
+func (i *Indexer) Bootstrap(ctx context.Context, cfg BootstrapConfig) error {
+	if cfg.Name == "" {
+		return fmt.Errorf("template name must not be empty")
+	}
+	payload, ok := payloadMappings[cfg.PayloadMapping]
+	if !ok {
+		return fmt.Errorf("unsupported payload mapping %q", cfg.PayloadMapping)
+	}
+
+	settings, err := loadTemplate("settings.json")
+	if err != nil {
+		return err
+	}
+	mappings, err := loadTemplate("mappings.json")
+	if err != nil {
+		return err
+	}
+	properties, err := templateProperties(mappings)
+	if err != nil {
+		return err
+	}
+	properties["payload"] = payload
+
+	components := []struct {
+		name string
+		body map[string]any
+	}{
+		{name: cfg.Name + "-settings", body: settings},
+		{name: cfg.Name + "-mappings", body: mappings},
+	}
+	composedOf := make([]string, 0, len(components))
+	for _, c := range components {
+		if err := i.putTemplate(ctx, c.body, func(body *bytes.Reader) (*esapi.Response, error) {
+			return i.client.Cluster.PutComponentTemplate(c.name, body, i.client.Cluster.PutComponentTemplate.WithContext(ctx))
+		}); err != nil {
+			return fmt.Errorf("put component template %s: %w", c.name, err)
+		}
+		composedOf = append(composedOf, c.name)
+	}
+
+	indexTemplate, err := loadTemplate("index_template.json")
+	if err != nil {
+		return err
+	}
+	pattern := i.index.pattern()
+	indexTemplate["index_patterns"] = []string{pattern}
+	indexTemplate["composed_of"] = composedOf
+	if i.dataStream {
+		indexTemplate["data_stream"] = map[string]any{}
+	}
+	if err := i.putTemplate(ctx, indexTemplate, func(body *bytes.Reader) (*esapi.Response, error) {
+		return i.client.Indices.PutIndexTemplate(cfg.Name, body, i.client.Indices.PutIndexTemplate.WithContext(ctx))
+	}); err != nil {
+		return fmt.Errorf("put index template %s: %w", cfg.Name, err)
+	}
+	i.logger.InfoContext(ctx, "elasticsearch templates installed",
+		"template", cfg.Name, "pattern", pattern, "payload_mapping", cfg.PayloadMapping)
+
+	drift, err := i.mappingDrift(ctx, pattern, properties)
+	if err != nil {
+		return err
+	}
+	if len(drift) == 0 {
+		return nil
+	}
+	if cfg.Strict {
+		return fmt.Errorf("%w: %s", ErrMappingDrift, strings.Join(drift, "; "))
+	}
+	for _, d := range drift {
+		i.logger.WarnContext(ctx, "elasticsearch mapping drifted from template", "template", cfg.Name, "drift", d)
+	}
+	return nil
+}
+
+func loadTemplate(name string) (map[string]any, error) {
+	raw, err := templateFiles.ReadFile("templates/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("read template %s: %w", name, err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, fmt.Errorf("parse template %s: %w", name, err)
+	}
+	return body, nil
+}
+
+// templateProperties returns the top-level mapping properties of a component
+// template body, which callers may modify in place.
+func templateProperties(body map[string]any) (map[string]map[string]any, error) {
+	tmpl, _ := body["template"].(map[string]any)
+	mappings, _ := tmpl["mappings"].(map[string]any)
+	raw, ok := mappings["properties"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("mappings template has no properties")
+	}
+
+	properties := make(map[string]map[string]any, len(raw))
+	for field, v := range raw {
+		prop, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("mapping of %s is not an object", field)
+		}
+		properties[field] = prop
+	}
+	// Install the typed copy so that overrides reach the template.
+	mappings["properties"] = properties
+	return properties, nil
+}
+
+func (i *Indexer) putTemplate(ctx context.Context, body map[string]any, put func(*bytes.Reader) (*esapi.Response, error)) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encode template: %w", err)
+	}
+	res, err := put(bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.IsError() {
+		return fmt.Errorf("unexpected response: %s", res.String())
+	}
+	return nil
+}
+
+// mappingDrift compares the mapping of every existing index matching pattern
+// against the expected top-level properties and describes each mismatch.
+func (i *Indexer) mappingDrift(ctx context.Context, pattern string, expected map[string]map[string]any) ([]string, error) {
+	res, err := i.client.Indices.GetMapping(
+		i.client.Indices.GetMapping.WithContext(ctx),
+		i.client.Indices.GetMapping.WithIndex(pattern),
+		i.client.Indices.GetMapping.WithAllowNoIndices(true),
+		i.client.Indices.GetMapping.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get mapping of %s: %w", pattern, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.IsError() {
+		return nil, fmt.Errorf("get mapping of %s: %s", pattern, res.String())
+	}
+
+	var live map[string]struct {
+		Mappings struct {
+			Properties map[string]map[string]any `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&live); err != nil {
+		return nil, fmt.Errorf("decode mapping of %s: %w", pattern, err)
+	}
+
+	var drift []string
+	for index, m := range live {
+		for field, want := range expected {
+			got, ok := m.Mappings.Properties[field]
+			if !ok {
+				drift = append(drift, fmt.Sprintf("%s: field %s is not mapped", index, field))
+				continue
+			}
+			for key, wantValue := range want {
+				if gotValue := mappingValue(got, key); gotValue != fmt.Sprint(wantValue) {
+					drift = append(drift, fmt.Sprintf("%s: field %s has %s %s, expected %v", index, field, key, gotValue, wantValue))
+				}
+			}
+		}
+	}
+	sort.Strings(drift)
+	return drift, nil
+}
+
+// mappingValue returns a mapping parameter as Elasticsearch reports it,
+// filling in the defaults it omits.
+func mappingValue(prop map[string]any, key string) string {
+	if v, ok := prop[key]; ok {
+		return fmt.Sprint(v)
+	}
+	switch key {
+	case "type":
+		return "object"
+	case "enabled", "dynamic":
+		return "true"
+	default:
+		return ""
+	}
+}
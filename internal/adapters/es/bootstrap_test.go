@@ -0,0 +1,148 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v8"
+)
+
+// templateStub is a stub Elasticsearch server that records installed
+// templates and serves a fixed live mapping.
+type templateStub struct {
+	mu        sync.Mutex
+	templates map[string]map[string]any
+	mapping   string
+}
+
+func newTemplateClient(t *testing.T, liveMapping string) (*elasticsearch.Client, *templateStub) {
+	t.Helper()
+
+	stub := &templateStub{templates: map[string]map[string]any{}, mapping: liveMapping}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method == http.MethodPut {
+			raw, _ := io.ReadAll(r.Body)
+			var body map[string]any
+			if err := json.Unmarshal(raw, &body); err != nil {
+				t.Errorf("decode template %s: %v", r.URL.Path, err)
+			}
+			stub.mu.Lock()
+			stub.templates[r.URL.Path] = body
+			stub.mu.Unlock()
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(stub.mapping))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	return client, stub
+}
+
+const matchingMapping = `{"messages-2024.03.09":{"mappings":{"dynamic":"strict","properties":{
+	"@timestamp":{"type":"date"},
+	"id":{"type":"keyword"},
+	"payload":{"type":"flattened"},
+	"metadata":{"type":"flattened"},
+	"status_code":{"type":"short"}}}}}`
+
+func TestBootstrapInstallsTemplates(t *testing.T) {
+	client, stub := newTemplateClient(t, matchingMapping)
+	indexer, err := NewIndexer(client, "messages-{yyyy.MM.dd}", WithDataStream("timestamp"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := indexer.Bootstrap(context.Background(), BootstrapConfig{Name: "kflow", PayloadMapping: PayloadDisabled}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, path := range []string{"/_component_template/kflow-settings", "/_component_template/kflow-mappings", "/_index_template/kflow"} {
+		if _, ok := stub.templates[path]; !ok {
+			t.Fatalf("expected %s to be installed, got %v", path, stub.templates)
+		}
+	}
+
+	indexTemplate := stub.templates["/_index_template/kflow"]
+	if got := indexTemplate["index_patterns"]; len(got.([]any)) != 1 || got.([]any)[0] != "messages-*" {
+		t.Fatalf("expected index pattern messages-*, got %v", got)
+	}
+	if got := indexTemplate["composed_of"].([]any); len(got) != 2 {
+		t.Fatalf("expected 2 component templates, got %v", got)
+	}
+	if _, ok := indexTemplate["data_stream"]; !ok {
+		t.Fatal("expected data_stream in data stream mode")
+	}
+
+	mappings := stub.templates["/_component_template/kflow-mappings"]
+	payload := mappings["template"].(map[string]any)["mappings"].(map[string]any)["properties"].(map[string]any)["payload"]
+	if got := payload.(map[string]any)["enabled"]; got != false {
+		t.Fatalf("expected disabled payload mapping, got %v", payload)
+	}
+}
+
+func TestBootstrapMappingDrift(t *testing.T) {
+	drifted := `{"messages":{"mappings":{"properties":{
+		"id":{"type":"text"},
+		"payload":{"properties":{"foo":{"type":"text"}}},
+		"metadata":{"type":"flattened"},
+		"status_code":{"type":"long"}}}}}`
+
+	tests := []struct {
+		name    string
+		mapping string
+		strict  bool
+		wantErr bool
+	}{
+		{name: "matching mapping", mapping: matchingMapping, strict: true},
+		{name: "no indices yet", mapping: `{}`, strict: true},
+		{name: "drift warns", mapping: drifted},
+		{name: "drift fails in strict mode", mapping: drifted, strict: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTemplateClient(t, tt.mapping)
+			indexer, err := NewIndexer(client, "messages")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			err = indexer.Bootstrap(context.Background(), BootstrapConfig{Name: "kflow", PayloadMapping: PayloadFlattened, Strict: tt.strict})
+			if tt.wantErr {
+				if !errors.Is(err, ErrMappingDrift) {
+					t.Fatalf("expected ErrMappingDrift, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBootstrapRejectsUnknownPayloadMapping(t *testing.T) {
+	client, _ := newTemplateClient(t, `{}`)
+	indexer, err := NewIndexer(client, "messages")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := indexer.Bootstrap(context.Background(), BootstrapConfig{Name: "kflow", PayloadMapping: "nested"}); err == nil {
+		t.Fatal("expected error for unknown payload mapping")
+	}
+}
@@ -0,0 +1,82 @@
+package es
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v8"
+)
+
+// ClientConfig describes how to reach and authenticate to Elasticsearch.
+type ClientConfig struct {
+	// Addresses and CloudID are mutually exclusive; exactly one must be set.
+	Addresses []string
+	CloudID   string
+
+	// Username and Password enable basic auth. APIKey is the base64-encoded
+	// "id:api_key" pair and is mutually exclusive with basic auth.
+	Username string
+	Password string
+	APIKey   string
+
+	// CACertFile is a PEM bundle used to verify the cluster certificate.
+	// CertificateFingerprint is the SHA-256 fingerprint of the cluster's CA or
+	// node certificate, hex-encoded with or without colons.
+	CACertFile             string
+	CertificateFingerprint string
+}
+
+// NewClient validates cfg and builds an Elasticsearch client from it.
+func NewClient(cfg ClientConfig) (*elasticsearch.Client, error) {
+	if (len(cfg.Addresses) == 0) == (cfg.CloudID == "") {
+		return nil, fmt.Errorf("exactly one of addresses or cloud id must be set")
+	}
+	if (cfg.Username == "") != (cfg.Password == "") {
+		return nil, fmt.Errorf("username and password must be set together")
+	}
+	if cfg.APIKey != "" && cfg.Username != "" {
+		return nil, fmt.Errorf("api key and basic auth are mutually exclusive")
+	}
+
+	esCfg := elasticsearch.Config{
+		Addresses: cfg.Addresses,
+		CloudID:   cfg.CloudID,
+		Username:  cfg.Username,
+		Password:  cfg.Password,
+		APIKey:    cfg.APIKey,
+	}
+
+	if cfg.CACertFile != "" {
+		caCert, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca cert file: %w", err)
+		}
+		esCfg.CACert = caCert
+	}
+
+	if cfg.CertificateFingerprint != "" {
+		fingerprint, err := normalizeFingerprint(cfg.CertificateFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		esCfg.CertificateFingerprint = fingerprint
+	}
+
+	client, err := elasticsearch.NewClient(esCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create client: %w", err)
+	}
+	return client, nil
+}
+
+// normalizeFingerprint strips the colons Elasticsearch and openssl print
+// between bytes and checks that what remains is a SHA-256 digest.
+func normalizeFingerprint(s string) (string, error) {
+	fingerprint := strings.ToLower(strings.ReplaceAll(s, ":", ""))
+	if b, err := hex.DecodeString(fingerprint); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("certificate fingerprint must be a hex-encoded SHA-256 digest")
+	}
+	return fingerprint, nil
+}
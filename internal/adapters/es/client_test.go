@@ -0,0 +1,73 @@
+package es
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewClient(t *testing.T) {
+	fingerprint := strings.Repeat("AB:", 31) + "AB"
+
+	tests := []struct {
+		name    string
+		cfg     ClientConfig
+		wantErr bool
+	}{
+		{name: "addresses", cfg: ClientConfig{Addresses: []string{"http://es1:9200"}}},
+		{name: "basic auth", cfg: ClientConfig{Addresses: []string{"http://es1:9200"}, Username: "elastic", Password: "changeme"}},
+		{name: "api key", cfg: ClientConfig{Addresses: []string{"https://es1:9200"}, APIKey: "aWQ6a2V5"}},
+		{name: "fingerprint with colons", cfg: ClientConfig{Addresses: []string{"https://es1:9200"}, CertificateFingerprint: fingerprint}},
+		{name: "no endpoint", cfg: ClientConfig{}, wantErr: true},
+		{name: "addresses and cloud id", cfg: ClientConfig{Addresses: []string{"http://es1:9200"}, CloudID: "deployment:ZXhhbXBsZS5jb20kYWJjJGRlZg=="}, wantErr: true},
+		{name: "username without password", cfg: ClientConfig{Addresses: []string{"http://es1:9200"}, Username: "elastic"}, wantErr: true},
+		{name: "api key and basic auth", cfg: ClientConfig{Addresses: []string{"http://es1:9200"}, Username: "elastic", Password: "changeme", APIKey: "aWQ6a2V5"}, wantErr: true},
+		{name: "short fingerprint", cfg: ClientConfig{Addresses: []string{"https://es1:9200"}, CertificateFingerprint: "abcd"}, wantErr: true},
+		{name: "missing ca file", cfg: ClientConfig{Addresses: []string{"https://es1:9200"}, CACertFile: filepath.Join(t.TempDir(), "ca.pem")}, wantErr: true},
+		{name: "malformed cloud id", cfg: ClientConfig{CloudID: "not-a-cloud-id"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if client == nil {
+				t.Fatal("expected client")
+			}
+		})
+	}
+}
+
+func TestNewClientCloudID(t *testing.T) {
+	// "example.com$abc$def" base64-encoded, as issued by Elastic Cloud.
+	client, err := NewClient(ClientConfig{CloudID: "deployment:ZXhhbXBsZS5jb20kYWJjJGRlZg==", APIKey: "aWQ6a2V5"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := client.Transport.(interface{ URLs() []*url.URL }).URLs()[0].Host; got != "abc.example.com" {
+		t.Fatalf("expected cloud host abc.example.com, got %s", got)
+	}
+}
+
+func TestNewClientReadsCACert(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is read at startup, so an unusable bundle is reported there
+	// rather than on the first request.
+	if _, err := NewClient(ClientConfig{Addresses: []string{"https://es1:9200"}, CACertFile: caFile}); err == nil {
+		t.Fatal("expected error for a CA file without certificates")
+	}
+}
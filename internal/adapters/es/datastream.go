@@ -0,0 +1,36 @@
+package es
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+)
+
+// dataStreamDoc is the source of a document written to a data stream: the
+// event plus the @timestamp field data streams require.
+type dataStreamDoc struct {
+	Timestamp string `json:"@timestamp"`
+	domain.MessageEvent
+}
+
+// eventTimestamp returns the time evt occurred: its timestampField metadata
+// entry, as RFC 3339 or epoch milliseconds, or now if the entry is absent.
+func (i *Indexer) eventTimestamp(evt domain.MessageEvent, now time.Time) (time.Time, error) {
+	raw, ok := evt.Metadata[i.timestampField]
+	if i.timestampField == "" || !ok || raw == "" {
+		return now, nil
+	}
+	return parseTimestamp(raw)
+}
+
+func parseTimestamp(raw string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return ts, nil
+	}
+	if millis, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(millis), nil
+	}
+	return time.Time{}, fmt.Errorf("timestamp %q is neither RFC 3339 nor epoch milliseconds", raw)
+}
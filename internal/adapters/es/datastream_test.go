@@ -0,0 +1,119 @@
+package es
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+func TestIndexerDataStreamMode(t *testing.T) {
+	client, stub := newTestClient(t)
+	stub.status = func(a bulkAction) int {
+		if a.Meta["_id"] == "msg-dup" {
+			return http.StatusConflict
+		}
+		return http.StatusCreated
+	}
+
+	indexer, err := NewIndexer(client, "logs-messages-default", WithDataStream("event_time"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ingested := time.Date(2024, time.March, 9, 12, 0, 0, 0, time.UTC)
+	indexer.now = func() time.Time { return ingested }
+
+	events := []domain.MessageEvent{
+		{ID: "msg-rfc3339", Metadata: map[string]string{"event_time": "2024-03-08T10:15:30.5+01:00"}},
+		{ID: "msg-millis", Metadata: map[string]string{"event_time": "1709892930000"}},
+		{ID: "msg-ingested"},
+		{ID: "msg-bad", Metadata: map[string]string{"event_time": "yesterday"}},
+		{ID: "msg-dup"},
+	}
+
+	results, err := indexer.Index(context.Background(), events)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if results[3].Status != http.StatusBadRequest || results[3].ErrorType != errorTypeTimestampParse {
+		t.Fatalf("expected unparsable timestamp to be rejected, got %+v", results[3])
+	}
+	if got := results[4].Outcome(); got != ports.IndexOutcomeSucceeded {
+		t.Fatalf("expected duplicate create to count as success, got outcome %v", got)
+	}
+
+	want := map[string]string{
+		"msg-rfc3339":  "2024-03-08T09:15:30.5Z",
+		"msg-millis":   "2024-03-08T10:15:30Z",
+		"msg-ingested": "2024-03-09T12:00:00Z",
+	}
+	actions := stub.recorded()
+	if len(actions) != 4 {
+		t.Fatalf("expected 4 bulk actions, got %d", len(actions))
+	}
+	for _, a := range actions[:3] {
+		if a.Type != "create" {
+			t.Fatalf("expected create action, got %s", a.Type)
+		}
+		id := a.Meta["_id"].(string)
+		if got := a.Doc["@timestamp"]; got != want[id] {
+			t.Fatalf("%s: expected @timestamp %s, got %v", id, want[id], got)
+		}
+		if a.Doc["id"] != id {
+			t.Fatalf("%s: expected the event fields alongside @timestamp, got %v", id, a.Doc)
+		}
+	}
+}
+
+func TestIndexerDataStreamTransientTimestamp(t *testing.T) {
+	client, stub := newTestClient(t)
+	indexer, err := NewIndexer(client, "logs-messages-default",
+		WithDataStream("kafka.timestamp"), WithTransientMetadata("kafka.timestamp"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	indexer.now = func() time.Time { return time.Date(2024, time.March, 9, 12, 0, 0, 0, time.UTC) }
+
+	events := []domain.MessageEvent{
+		{ID: "msg-1", Metadata: map[string]string{"kafka.timestamp": "2024-03-08T10:15:30Z"}},
+	}
+	if _, err := indexer.Index(context.Background(), events); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	actions := stub.recorded()
+	if len(actions) != 1 {
+		t.Fatalf("expected 1 bulk action, got %d", len(actions))
+	}
+	if got := actions[0].Doc["@timestamp"]; got != "2024-03-08T10:15:30Z" {
+		t.Fatalf("expected @timestamp from the record timestamp, got %v", got)
+	}
+	if _, ok := actions[0].Doc["metadata"]; ok {
+		t.Fatalf("expected the record timestamp to be left out of the document, got %v", actions[0].Doc["metadata"])
+	}
+}
+
+func TestIndexerDataStreamRejectsOperations(t *testing.T) {
+	client, stub := newTestClient(t)
+	indexer, err := NewIndexer(client, "logs-messages-default", WithDataStream("timestamp"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	results, err := indexer.Index(context.Background(), []domain.MessageEvent{
+		{ID: "msg-1", Metadata: map[string]string{"op": "upsert"}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if results[0].Status != http.StatusBadRequest || results[0].ErrorType != errorTypeUnsupportedOperation {
+		t.Fatalf("expected upsert into a data stream to be rejected, got %+v", results[0])
+	}
+	if len(stub.recorded()) != 0 {
+		t.Fatalf("expected no bulk request, got %v", stub.recorded())
+	}
+}
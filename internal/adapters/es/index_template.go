@@ -0,0 +1,253 @@
+package es
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+)
+
+// Placeholder prefixes for field-based index routing.
+const (
+	placeholderMetadata = "metadata."
+	placeholderPayload  = "payload."
+)
+
+// dateTokens maps the date pattern tokens accepted in index templates onto Go
+// layout elements, longest token first.
+var dateTokens = []struct{ token, layout string }{
+	{"yyyy", "2006"},
+	{"yy", "06"},
+	{"MM", "01"},
+	{"dd", "02"},
+	{"HH", "15"},
+}
+
+// invalidIndexChars are the characters Elasticsearch forbids in index names.
+const invalidIndexChars = `\/*?"<>| ,#:`
+
+// indexTemplate resolves the target index of each event from a name such as
+// "messages-{yyyy.MM.dd}" or "events-{metadata.tenant}". Placeholders are:
+//
+//   - {metadata.<key>}: the event's metadata value for key
+//   - {payload.<path>}: a payload field, with dots descending into objects
+//   - any other {...}: a UTC ingestion date built from yyyy, yy, MM, dd and
+//     HH, with other characters copied as-is
+//
+// A name without placeholders routes every event to that index.
+type indexTemplate struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal string
+
+	// Exactly one of the following is set for a placeholder.
+	metadataKey string
+	payloadPath []string
+	dateLayout  string
+}
+
+func parseIndexTemplate(s string) (indexTemplate, error) {
+	var t indexTemplate
+	for rest := s; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:open]})
+		}
+
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return indexTemplate{}, fmt.Errorf("index template %q: unclosed placeholder", s)
+		}
+		part, err := parsePlaceholder(rest[open+1 : open+end])
+		if err != nil {
+			return indexTemplate{}, fmt.Errorf("index template %q: %w", s, err)
+		}
+		t.parts = append(t.parts, part)
+		rest = rest[open+end+1:]
+	}
+	literals := t.literals()
+	if strings.ContainsRune(literals, '}') {
+		return indexTemplate{}, fmt.Errorf("index template %q: unexpected '}'", s)
+	}
+	if strings.ContainsAny(literals, invalidIndexChars) || strings.ToLower(literals) != literals {
+		return indexTemplate{}, fmt.Errorf("index template %q: index names must be lower case without %q", s, invalidIndexChars)
+	}
+	return t, nil
+}
+
+func parsePlaceholder(p string) (templatePart, error) {
+	switch {
+	case strings.HasPrefix(p, placeholderMetadata):
+		key := strings.TrimPrefix(p, placeholderMetadata)
+		if key == "" {
+			return templatePart{}, fmt.Errorf("empty metadata key in {%s}", p)
+		}
+		return templatePart{metadataKey: key}, nil
+	case strings.HasPrefix(p, placeholderPayload):
+		path := strings.Split(strings.TrimPrefix(p, placeholderPayload), ".")
+		for _, elem := range path {
+			if elem == "" {
+				return templatePart{}, fmt.Errorf("empty payload path element in {%s}", p)
+			}
+		}
+		return templatePart{payloadPath: path}, nil
+	default:
+		layout, ok := dateLayout(p)
+		if !ok {
+			return templatePart{}, fmt.Errorf("unknown placeholder {%s}", p)
+		}
+		return templatePart{dateLayout: layout}, nil
+	}
+}
+
+// dateLayout converts a date pattern into a Go time layout. It reports false
+// if the pattern contains no date token or a letter that is not part of one.
+func dateLayout(pattern string) (string, bool) {
+	var b strings.Builder
+	found := false
+next:
+	for rest := pattern; rest != ""; {
+		for _, dt := range dateTokens {
+			if strings.HasPrefix(rest, dt.token) {
+				b.WriteString(dt.layout)
+				rest = rest[len(dt.token):]
+				found = true
+				continue next
+			}
+		}
+		c := rest[0]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			return "", false
+		}
+		b.WriteByte(c)
+		rest = rest[1:]
+	}
+	return b.String(), found
+}
+
+func (t indexTemplate) literals() string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		b.WriteString(p.literal)
+	}
+	return b.String()
+}
+
+// dated reports whether the template contains a date placeholder, so that
+// the index an event resolves to depends on when it is ingested.
+func (t indexTemplate) dated() bool {
+	for _, p := range t.parts {
+		if p.dateLayout != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// pattern returns an index pattern matching every index the template can
+// resolve to, with each placeholder replaced by a wildcard.
+func (t indexTemplate) pattern() string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch {
+		case p.literal != "":
+			b.WriteString(p.literal)
+		case !strings.HasSuffix(b.String(), "*"):
+			b.WriteByte('*')
+		}
+	}
+	return b.String()
+}
+
+// resolve returns the index for evt ingested at now. Field values are
+// lower-cased; an event lacking a referenced field, or whose values produce
+// an invalid index name, is reported as an error.
+func (t indexTemplate) resolve(evt domain.MessageEvent, now time.Time) (string, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch {
+		case p.metadataKey != "":
+			v, ok := evt.Metadata[p.metadataKey]
+			if !ok || v == "" {
+				return "", fmt.Errorf("metadata field %q is missing", p.metadataKey)
+			}
+			b.WriteString(strings.ToLower(v))
+		case p.payloadPath != nil:
+			v, err := payloadValue(evt.Payload, p.payloadPath)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(strings.ToLower(v))
+		case p.dateLayout != "":
+			b.WriteString(now.UTC().Format(p.dateLayout))
+		default:
+			b.WriteString(p.literal)
+		}
+	}
+
+	index := b.String()
+	if err := validateIndexName(index); err != nil {
+		return "", err
+	}
+	return index, nil
+}
+
+// payloadValue formats the scalar found at path in the payload.
+func payloadValue(payload map[string]any, path []string) (string, error) {
+	v, err := payloadField(payload, path)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return "", fmt.Errorf("payload field %q is empty", strings.Join(path, "."))
+		}
+		return v, nil
+	case float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("payload field %q is not a scalar", strings.Join(path, "."))
+	}
+}
+
+// payloadField returns the raw decoded value at path, descending into nested
+// objects.
+func payloadField(payload map[string]any, path []string) (any, error) {
+	var v any = payload
+	for _, elem := range path {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("payload field %q is missing", strings.Join(path, "."))
+		}
+		if v, ok = obj[elem]; !ok {
+			return nil, fmt.Errorf("payload field %q is missing", strings.Join(path, "."))
+		}
+	}
+	return v, nil
+}
+
+// validateIndexName applies the Elasticsearch index naming rules.
+func validateIndexName(index string) error {
+	switch {
+	case index == "", index == ".", index == "..":
+		return fmt.Errorf("invalid index name %q", index)
+	case strings.ContainsAny(index, invalidIndexChars):
+		return fmt.Errorf("index name %q contains a forbidden character", index)
+	case strings.ContainsAny(index[:1], "-_+"):
+		return fmt.Errorf("index name %q must not start with '-', '_' or '+'", index)
+	case len(index) > 255:
+		return fmt.Errorf("index name %q is longer than 255 bytes", index)
+	case strings.ToLower(index) != index:
+		return fmt.Errorf("index name %q must be lower case", index)
+	}
+	return nil
+}
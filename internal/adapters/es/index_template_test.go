@@ -0,0 +1,103 @@
+package es
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+)
+
+func TestIndexTemplateResolve(t *testing.T) {
+	now := time.Date(2024, time.March, 9, 23, 30, 0, 0, time.FixedZone("CET", 3600))
+	evt := domain.MessageEvent{
+		ID:       "msg-1",
+		Metadata: map[string]string{"tenant": "Acme", "region": "eu/west"},
+		Payload: map[string]any{
+			"kind":     "Order",
+			"customer": map[string]any{"tier": "gold"},
+			"shard":    float64(3),
+			"items":    []any{"a"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{name: "static", template: "messages", want: "messages"},
+		{name: "daily in utc", template: "messages-{yyyy.MM.dd}", want: "messages-2024.03.09"},
+		{name: "hourly", template: "messages-{yy-MM-dd-HH}", want: "messages-24-03-09-22"},
+		{name: "metadata lower-cased", template: "events-{metadata.tenant}", want: "events-acme"},
+		{name: "payload field", template: "{payload.kind}-events", want: "order-events"},
+		{name: "nested payload field", template: "events-{payload.customer.tier}", want: "events-gold"},
+		{name: "numeric payload field", template: "events-{payload.shard}", want: "events-3"},
+		{name: "combined", template: "{metadata.tenant}-{payload.kind}-{yyyy.MM}", want: "acme-order-2024.03"},
+		{name: "missing metadata", template: "events-{metadata.missing}", wantErr: true},
+		{name: "missing payload", template: "events-{payload.customer.missing}", wantErr: true},
+		{name: "non-scalar payload", template: "events-{payload.items}", wantErr: true},
+		{name: "forbidden character", template: "events-{metadata.region}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseIndexTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("parse %q: %v", tt.template, err)
+			}
+
+			got, err := tmpl.resolve(evt, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got index %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseIndexTemplateRejectsInvalidTemplates(t *testing.T) {
+	for _, template := range []string{
+		"messages-{yyyy.MM.dd",
+		"messages-}",
+		"messages-{}",
+		"messages-{metadata.}",
+		"messages-{payload.a..b}",
+		"messages-{tenant}",
+		"messages-{yyyy.ww}",
+		"Messages-{yyyy}",
+		"messages #{yyyy}",
+	} {
+		if _, err := parseIndexTemplate(template); err == nil {
+			t.Fatalf("expected error for template %q", template)
+		}
+	}
+}
+
+func TestIndexTemplatePattern(t *testing.T) {
+	tests := map[string]string{
+		"messages":                           "messages",
+		"messages-{yyyy.MM.dd}":              "messages-*",
+		"{metadata.tenant}-events":           "*-events",
+		"events-{metadata.tenant}{yyyy.MM}":  "events-*",
+		"logs-{payload.kind}-{metadata.env}": "logs-*-*",
+	}
+
+	for template, want := range tests {
+		tmpl, err := parseIndexTemplate(template)
+		if err != nil {
+			t.Fatalf("parse %q: %v", template, err)
+		}
+		if got := tmpl.pattern(); got != want {
+			t.Fatalf("pattern(%q) = %q, expected %q", template, got, want)
+		}
+	}
+}
@@ -5,127 +5,508 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
+	"time"
 
 	elasticsearch "github.com/elastic/go-elasticsearch/v8"
 
 	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
 )
 
-// Error values returned by the indexer for callers to react to.
+// Error values returned by the indexer for callers to react to. Both wrap
+// ports.ErrRetriable so the service layer can back off and retry.
 var (
-	ErrTooManyRequests = fmt.Errorf("elasticsearch: too many requests (429)")
-	ErrServerError     = fmt.Errorf("elasticsearch: server error (5xx)")
+	ErrTooManyRequests = fmt.Errorf("elasticsearch: too many requests (429): %w", ports.ErrRetriable)
+	ErrServerError     = fmt.Errorf("elasticsearch: server error (5xx): %w", ports.ErrRetriable)
+)
+
+// Refresh controls when changes made by a bulk request become visible to
+// search, mirroring the Elasticsearch refresh query parameter.
+type Refresh string
+
+// Supported refresh policies. RefreshWaitFor blocks each bulk request until
+// the next refresh and is intended for tests only.
+const (
+	RefreshFalse   Refresh = "false"
+	RefreshTrue    Refresh = "true"
+	RefreshWaitFor Refresh = "wait_for"
+)
+
+// ParseRefresh validates s as a refresh policy.
+func ParseRefresh(s string) (Refresh, error) {
+	switch r := Refresh(s); r {
+	case RefreshFalse, RefreshTrue, RefreshWaitFor:
+		return r, nil
+	default:
+		return "", fmt.Errorf("invalid refresh policy %q: must be one of false, true, wait_for", s)
+	}
+}
+
+// Error types reported for events rejected before they are sent.
+const (
+	// errorTypeIndexResolution is reported when the index template could not
+	// be resolved, e.g. because a referenced field is missing.
+	errorTypeIndexResolution = "index_resolution_exception"
+	// errorTypeTimestampParse is reported when the timestamp field of an
+	// event bound for a data stream cannot be parsed.
+	errorTypeTimestampParse = "timestamp_parse_exception"
+	// errorTypeUnsupportedOperation is reported when the operation an event
+	// requests is unknown, lacks a document ID, or cannot target a data
+	// stream.
+	errorTypeUnsupportedOperation = "unsupported_operation_exception"
+	// errorTypeVersionResolution is reported when external versioning is
+	// enabled and the version of an event is missing or invalid.
+	errorTypeVersionResolution = "version_resolution_exception"
 )
 
 // Indexer implements ports.DataIndexer using the Elasticsearch Bulk API.
 type Indexer struct {
-	client *elasticsearch.Client
-	index  string
+	client  *elasticsearch.Client
+	index   indexTemplate
+	now     func() time.Time
+	refresh Refresh
+	metrics ports.Metrics
+	logger  *slog.Logger
+
+	// dataStream switches to create actions with an @timestamp taken from
+	// the timestampField metadata entry, or the ingestion time.
+	dataStream     bool
+	timestampField string
+
+	// versionType, if set, sends index and delete actions with the external
+	// version read from versionField.
+	versionType   VersionType
+	versionField  string
+	versionSource versionSource
+
+	// transientMetadata are metadata keys read while building an action but
+	// left out of the stored document.
+	transientMetadata []string
+}
+
+// Option configures an Indexer.
+type Option func(*Indexer)
+
+// WithMetrics records bulk request metrics on m.
+func WithMetrics(m ports.Metrics) Option {
+	return func(i *Indexer) {
+		i.metrics = m
+	}
+}
+
+// WithLogger sets the logger used by the indexer.
+func WithLogger(l *slog.Logger) Option {
+	return func(i *Indexer) {
+		i.logger = l
+	}
+}
+
+// WithRefresh sets the refresh policy applied to bulk requests. The default
+// is RefreshFalse, leaving visibility to the index refresh interval.
+func WithRefresh(refresh Refresh) Option {
+	return func(i *Indexer) {
+		i.refresh = refresh
+	}
+}
+
+// WithDataStream targets data streams instead of regular indices. Each event
+// is sent as a create action, as data streams require, with an @timestamp
+// taken from its timestampField metadata entry, or the ingestion time when
+// the entry is absent. A re-delivered event whose ID already exists comes back
+// as a 409 conflict, which counts as success.
+func WithDataStream(timestampField string) Option {
+	return func(i *Indexer) {
+		i.dataStream = true
+		i.timestampField = timestampField
+	}
+}
+
+// WithExternalVersion sends index and delete actions with an external version
+// of the given type, read from source: "metadata.<key>" or "payload.<path>".
+// A write whose version is not newer than the stored document's fails with a
+// 409 conflict, which counts as success, so stale redeliveries become no-ops.
+// Events without a valid version are rejected. Updates are not versioned, as
+// Elasticsearch does not support external versions for them, and versioning
+// cannot be combined with data stream mode.
+func WithExternalVersion(versionType VersionType, source string) Option {
+	return func(i *Indexer) {
+		i.versionType = versionType
+		i.versionField = source
+	}
+}
+
+// WithTransientMetadata strips the given metadata entries from stored
+// documents. They can still route events or carry their version, e.g. an
+// offset added only for versioning.
+func WithTransientMetadata(keys ...string) Option {
+	return func(i *Indexer) {
+		i.transientMetadata = append(i.transientMetadata, keys...)
+	}
 }
 
-// NewIndexer constructs a new Indexer.
-func NewIndexer(client *elasticsearch.Client, index string) (*Indexer, error) {
+// NewIndexer constructs a new Indexer. index is either a fixed index name or
+// a template such as "messages-{yyyy.MM.dd}" or "events-{metadata.tenant}"
+// that is resolved per event; see indexTemplate for the placeholders.
+func NewIndexer(client *elasticsearch.Client, index string, opts ...Option) (*Indexer, error) {
 	if client == nil {
 		return nil, fmt.Errorf("client must not be nil")
 	}
 	if index == "" {
 		return nil, fmt.Errorf("index must not be empty")
 	}
-	return &Indexer{
-		client: client,
-		index:  index,
-	}, nil
+	tmpl, err := parseIndexTemplate(index)
+	if err != nil {
+		return nil, err
+	}
+	i := &Indexer{
+		client:  client,
+		index:   tmpl,
+		now:     time.Now,
+		refresh: RefreshFalse,
+		metrics: ports.NopMetrics{},
+		logger:  slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	if i.metrics == nil {
+		i.metrics = ports.NopMetrics{}
+	}
+	if i.logger == nil {
+		i.logger = slog.New(slog.DiscardHandler)
+	}
+	if _, err := ParseRefresh(string(i.refresh)); err != nil {
+		return nil, err
+	}
+	if i.versionType != "" {
+		if _, err := ParseVersionType(string(i.versionType)); err != nil {
+			return nil, err
+		}
+		if i.dataStream {
+			return nil, fmt.Errorf("external versioning is not supported in data stream mode")
+		}
+		if i.versionSource, err = parseVersionSource(i.versionField); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
 }
 
 // Index implements ports.DataIndexer by sending documents via the Bulk API
-// with refresh=wait_for (suitable for tests).
-func (i *Indexer) Index(ctx context.Context, events []domain.MessageEvent) error {
+// with the configured refresh policy. Per-item failures are reported in the
+// returned results rather than as an error; an event whose index cannot be
+// resolved, or whose operation is invalid, is rejected without being sent.
+func (i *Indexer) Index(ctx context.Context, events []domain.MessageEvent) ([]ports.IndexResult, error) {
 	if len(events) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
 
-	for _, evt := range events {
-		// Action line
-		meta := map[string]any{
-			"index": map[string]any{
-				"_index": i.index,
-				"_id":    evt.ID,
-			},
+	results := make([]ports.IndexResult, len(events))
+	// sent maps each bulk item back to its position in events.
+	sent := make([]int, 0, len(events))
+	now := i.now()
+
+	for idx, evt := range events {
+		item, rejected := i.buildItem(evt, now)
+		if rejected != nil {
+			results[idx] = ports.IndexResult{
+				Status:    http.StatusBadRequest,
+				ErrorType: rejected.errorType,
+				Reason:    rejected.err.Error(),
+			}
+			continue
 		}
-		if err := enc.Encode(meta); err != nil {
-			return fmt.Errorf("encode bulk meta: %w", err)
+
+		// Action line
+		if err := enc.Encode(map[string]any{item.action: item.meta}); err != nil {
+			return nil, fmt.Errorf("encode bulk meta: %w", err)
 		}
 
-		// Document line
-		if err := enc.Encode(evt); err != nil {
-			return fmt.Errorf("encode bulk doc: %w", err)
+		// Document line; delete actions have none.
+		if item.doc != nil {
+			if err := enc.Encode(item.doc); err != nil {
+				return nil, fmt.Errorf("encode bulk doc: %w", err)
+			}
 		}
+		sent = append(sent, idx)
+	}
+
+	if len(sent) == 0 {
+		return results, nil
 	}
 
+	start := time.Now()
 	res, err := i.client.Bulk(
 		bytes.NewReader(buf.Bytes()),
 		i.client.Bulk.WithContext(ctx),
-		i.client.Bulk.WithRefresh("wait_for"),
+		i.client.Bulk.WithRefresh(string(i.refresh)),
 	)
+	took := time.Since(start)
+	i.metrics.BulkCompleted(took, len(sent))
 	if err != nil {
-		return fmt.Errorf("bulk request: %w", err)
+		// Transport failures (refused connections, timeouts) are as
+		// transient as a 5xx response.
+		return nil, fmt.Errorf("bulk request: %w: %w", ports.ErrRetriable, err)
 	}
 	defer func() {
 		_ = res.Body.Close()
 	}()
+	i.logger.DebugContext(ctx, "bulk request completed",
+		"events", len(sent), "status", res.StatusCode, "took", took)
 
 	if res.StatusCode == http.StatusConflict {
 		// 409 Conflict: idempotent conflict, ignore per policy.
-		return nil
+		for _, idx := range sent {
+			results[idx].Status = http.StatusConflict
+		}
+		return results, nil
 	}
 
 	if res.StatusCode == http.StatusTooManyRequests {
-		return ErrTooManyRequests
+		return nil, ErrTooManyRequests
 	}
 
 	if res.StatusCode >= 500 && res.StatusCode <= 599 {
-		return ErrServerError
+		return nil, ErrServerError
 	}
 
 	if res.IsError() {
-		return fmt.Errorf("bulk error: %s", res.String())
+		return nil, fmt.Errorf("bulk error: %s", res.String())
 	}
 
-	// Inspect per-item errors in the bulk response.
-	var body struct {
-		Errors bool `json:"errors"`
-		Items  []map[string]struct {
-			Status int `json:"status"`
-		} `json:"items"`
+	itemResults, err := decodeBulkResults(res.Body, len(sent))
+	if err != nil {
+		return nil, err
 	}
+	for k, idx := range sent {
+		results[idx] = itemResults[k]
+	}
+	return results, nil
+}
 
-	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+// bulkItem is a single action of a bulk request.
+type bulkItem struct {
+	action string
+	meta   map[string]any
+	doc    any
+}
+
+// itemError rejects a single event before it is sent, reported to the caller
+// as a 400 result with the given error type.
+type itemError struct {
+	errorType string
+	err       error
+}
+
+// buildItem maps evt onto its bulk action according to its operation: an
+// index action by default, or a create action carrying @timestamp in data
+// stream mode; an update, optionally as an upsert or running a stored script;
+// or a delete. Index and delete actions carry the event's external version
+// when versioning is enabled.
+func (i *Indexer) buildItem(evt domain.MessageEvent, now time.Time) (bulkItem, *itemError) {
+	op := evt.Operation()
+
+	// Operations on an existing document resolve its index from the event
+	// alone. A tombstone carries no payload and only the record metadata, so
+	// a template referencing other fields cannot route it.
+	index, err := i.index.resolve(evt, now)
+	if err != nil {
+		if op != domain.OperationIndex {
+			err = fmt.Errorf("operation %q must carry the fields of the index template: %w", op, err)
+		}
+		return bulkItem{}, &itemError{errorType: errorTypeIndexResolution, err: err}
+	}
+
+	if op != domain.OperationIndex {
+		// A date placeholder resolves to the current index, which need not
+		// be the one holding the document.
+		if i.index.dated() {
+			return bulkItem{}, &itemError{
+				errorType: errorTypeUnsupportedOperation,
+				err:       fmt.Errorf("operation %q is not supported with a date-based index template", op),
+			}
+		}
+		if i.dataStream {
+			return bulkItem{}, &itemError{
+				errorType: errorTypeUnsupportedOperation,
+				err:       fmt.Errorf("operation %q is not supported in data stream mode", op),
+			}
+		}
+		if evt.ID == "" {
+			return bulkItem{}, &itemError{
+				errorType: errorTypeUnsupportedOperation,
+				err:       fmt.Errorf("operation %q requires an event id", op),
+			}
+		}
+	}
+
+	item := bulkItem{
+		action: "index",
+		meta:   map[string]any{"_index": index, "_id": evt.ID},
+	}
+
+	if i.versionType != "" && (op == domain.OperationIndex || op == domain.OperationDelete) {
+		version, err := i.versionSource.resolve(evt)
+		if err != nil {
+			return bulkItem{}, &itemError{errorType: errorTypeVersionResolution, err: err}
+		}
+		item.meta["version"] = version
+		item.meta["version_type"] = string(i.versionType)
+	}
+
+	// The stored document leaves out the entries only read while building
+	// the action.
+	stored := i.stripTransientMetadata(evt)
+	item.doc = stored
+
+	switch op {
+	case domain.OperationIndex:
+		if i.dataStream {
+			ts, err := i.eventTimestamp(evt, now)
+			if err != nil {
+				return bulkItem{}, &itemError{errorType: errorTypeTimestampParse, err: err}
+			}
+			item.action = "create"
+			item.doc = dataStreamDoc{Timestamp: ts.UTC().Format(time.RFC3339Nano), MessageEvent: stored}
+		}
+	case domain.OperationUpdate, domain.OperationUpsert:
+		item.action = "update"
+		item.doc = updateDoc(stored, op == domain.OperationUpsert)
+	case domain.OperationDelete:
+		item.action = "delete"
+		item.doc = nil
+	default:
+		return bulkItem{}, &itemError{
+			errorType: errorTypeUnsupportedOperation,
+			err:       fmt.Errorf("unsupported operation %q: must be one of index, update, upsert, delete", op),
+		}
+	}
+
+	return item, nil
+}
+
+// stripTransientMetadata returns evt without the transient metadata entries,
+// copying its metadata only when one of them is present.
+func (i *Indexer) stripTransientMetadata(evt domain.MessageEvent) domain.MessageEvent {
+	present := func(key string) bool {
+		_, ok := evt.Metadata[key]
+		return ok
+	}
+	if !slices.ContainsFunc(i.transientMetadata, present) {
+		return evt
+	}
+	evt.Metadata = maps.Clone(evt.Metadata)
+	for _, key := range i.transientMetadata {
+		delete(evt.Metadata, key)
+	}
+	return evt
+}
+
+// updateDoc builds the body of an update action. Without a script the event
+// is merged into the stored document as a partial doc, so payload fields it
+// omits are kept, and an event without a payload leaves it untouched. With
+// the stored script named by the script metadata entry, the payload is
+// passed as the script's params. An upsert creates the document from the
+// event when it does not exist yet.
+func updateDoc(evt domain.MessageEvent, upsert bool) map[string]any {
+	scriptID := evt.Metadata[domain.MetadataScript]
+	if scriptID == "" {
+		doc := map[string]any{"id": evt.ID, "status_code": evt.StatusCode}
+		if evt.Payload != nil {
+			doc["payload"] = evt.Payload
+		}
+		if len(evt.Metadata) > 0 {
+			doc["metadata"] = evt.Metadata
+		}
+		return map[string]any{"doc": doc, "doc_as_upsert": upsert}
+	}
+
+	script := map[string]any{"id": scriptID}
+	if len(evt.Payload) > 0 {
+		script["params"] = evt.Payload
+	}
+	body := map[string]any{"script": script}
+	if upsert {
+		body["upsert"] = evt
+	}
+	return body
+}
+
+// bulkResponse mirrors the parts of the Bulk API response we inspect.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// decodeBulkResults maps each bulk response item onto a ports.IndexResult,
+// preserving request order.
+func decodeBulkResults(r io.Reader, expected int) ([]ports.IndexResult, error) {
+	var body bulkResponse
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
 		// If decoding fails, surface a generic error.
-		return fmt.Errorf("decode bulk response: %w", err)
+		return nil, fmt.Errorf("decode bulk response: %w", err)
 	}
 
-	if !body.Errors {
-		return nil
+	if len(body.Items) != expected {
+		return nil, fmt.Errorf("bulk response has %d items, expected %d", len(body.Items), expected)
 	}
 
-	for _, item := range body.Items {
-		for _, v := range item {
-			switch {
-			case v.Status == http.StatusConflict:
-				// 409 Conflict: ignore.
-				continue
-			case v.Status == http.StatusTooManyRequests:
-				return ErrTooManyRequests
-			case v.Status >= 500 && v.Status <= 599:
-				return ErrServerError
+	results := make([]ports.IndexResult, len(body.Items))
+	for idx, item := range body.Items {
+		// Each item holds a single entry keyed by its action type.
+		for action, v := range item {
+			results[idx].Status = v.Status
+			if action == "delete" && v.Status == http.StatusNotFound && v.Error == nil {
+				// The document is already gone; deletes are idempotent.
+				results[idx].Status = http.StatusOK
+			}
+			if v.Error != nil {
+				results[idx].ErrorType = v.Error.Type
+				results[idx].Reason = v.Error.Reason
 			}
 		}
 	}
 
-	return nil
+	return results, nil
 }
 
+// HealthCheck implements ports.HealthChecker by querying cluster health. A
+// red cluster is reported as unhealthy; yellow is acceptable.
+func (i *Indexer) HealthCheck(ctx context.Context) error {
+	res, err := i.client.Cluster.Health(i.client.Cluster.Health.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("cluster health request: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.IsError() {
+		return fmt.Errorf("cluster health error: %s", res.Status())
+	}
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decode cluster health: %w", err)
+	}
+	if body.Status == "red" {
+		return fmt.Errorf("cluster status is red")
+	}
+	return nil
+}
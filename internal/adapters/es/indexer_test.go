@@ -0,0 +1,310 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v8"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+// bulkStub records the bulk requests received by a stub Elasticsearch server.
+type bulkStub struct {
+	mu      sync.Mutex
+	refresh string
+	actions []bulkAction
+
+	// status, if set, picks the status reported for each item; by default
+	// every item is created.
+	status func(bulkAction) int
+}
+
+// bulkAction is a decoded bulk action line and the document line after it.
+type bulkAction struct {
+	Type string
+	Meta map[string]any
+	Doc  map[string]any
+}
+
+func (b *bulkStub) recorded() []bulkAction {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.actions
+}
+
+// newTestClient returns a client pointed at a stub server that records each
+// bulk request and reports every item as created.
+func newTestClient(t *testing.T) (*elasticsearch.Client, *bulkStub) {
+	t.Helper()
+
+	stub := &bulkStub{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var actions []bulkAction
+		dec := json.NewDecoder(r.Body)
+		for dec.More() {
+			var line map[string]map[string]any
+			if err := dec.Decode(&line); err != nil {
+				t.Errorf("decode bulk action: %v", err)
+				return
+			}
+			for typ, meta := range line {
+				action := bulkAction{Type: typ, Meta: meta}
+				if typ != "delete" {
+					if err := dec.Decode(&action.Doc); err != nil {
+						t.Errorf("decode bulk document: %v", err)
+						return
+					}
+				}
+				actions = append(actions, action)
+			}
+		}
+
+		stub.mu.Lock()
+		stub.refresh = r.URL.Query().Get("refresh")
+		stub.actions = append(stub.actions, actions...)
+		stub.mu.Unlock()
+
+		items := make([]map[string]any, len(actions))
+		for i, a := range actions {
+			status := http.StatusCreated
+			if stub.status != nil {
+				status = stub.status(a)
+			}
+			items[i] = map[string]any{a.Type: map[string]any{"status": status}}
+		}
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"errors": false, "items": items})
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	return client, stub
+}
+
+func TestIndexerTransportErrorIsRetriable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}, DisableRetry: true})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	indexer, err := NewIndexer(client, "messages")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_, err = indexer.Index(context.Background(), []domain.MessageEvent{{ID: "msg-1"}})
+	if !errors.Is(err, ports.ErrRetriable) {
+		t.Fatalf("expected a retriable error for an unreachable cluster, got %v", err)
+	}
+}
+
+func TestIndexerRefreshPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "default", want: "false"},
+		{name: "true", opts: []Option{WithRefresh(RefreshTrue)}, want: "true"},
+		{name: "wait_for", opts: []Option{WithRefresh(RefreshWaitFor)}, want: "wait_for"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, stub := newTestClient(t)
+			indexer, err := NewIndexer(client, "messages", tt.opts...)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if _, err := indexer.Index(context.Background(), []domain.MessageEvent{{ID: "msg-1"}}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if stub.refresh != tt.want {
+				t.Fatalf("expected refresh=%s, got %s", tt.want, stub.refresh)
+			}
+		})
+	}
+}
+
+func TestNewIndexerRejectsInvalidRefresh(t *testing.T) {
+	client, _ := newTestClient(t)
+	if _, err := NewIndexer(client, "messages", WithRefresh("sometimes")); err == nil {
+		t.Fatal("expected error for invalid refresh policy")
+	}
+}
+
+func TestIndexerRoutesEventsByTemplate(t *testing.T) {
+	client, stub := newTestClient(t)
+	indexer, err := NewIndexer(client, "events-{metadata.tenant}-{yyyy.MM}")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	indexer.now = func() time.Time { return time.Date(2024, time.March, 9, 12, 0, 0, 0, time.UTC) }
+
+	events := []domain.MessageEvent{
+		{ID: "msg-1", Metadata: map[string]string{"tenant": "Acme"}},
+		{ID: "msg-2"},
+		{ID: "msg-3", Metadata: map[string]string{"tenant": "globex"}},
+	}
+
+	results, err := indexer.Index(context.Background(), events)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(results) != len(events) {
+		t.Fatalf("expected %d results, got %d", len(events), len(results))
+	}
+
+	if results[0].Status != http.StatusCreated || results[2].Status != http.StatusCreated {
+		t.Fatalf("expected routed events to be created, got %+v", results)
+	}
+	if results[1].Status != http.StatusBadRequest || results[1].ErrorType != errorTypeIndexResolution {
+		t.Fatalf("expected unresolvable event to be rejected, got %+v", results[1])
+	}
+
+	actions := stub.recorded()
+	if len(actions) != 2 {
+		t.Fatalf("expected 2 bulk actions, got %d", len(actions))
+	}
+	if got := actions[0].Meta["_index"]; got != "events-acme-2024.03" {
+		t.Fatalf("expected index events-acme-2024.03, got %v", got)
+	}
+	if got := actions[1].Meta["_index"]; got != "events-globex-2024.03" {
+		t.Fatalf("expected index events-globex-2024.03, got %v", got)
+	}
+}
+
+func TestIndexerOperationsOnTemplatedIndex(t *testing.T) {
+	tombstone := domain.MessageEvent{ID: "msg-1", Metadata: map[string]string{"op": "delete"}}
+	routed := domain.MessageEvent{ID: "msg-1", Metadata: map[string]string{"op": "delete", "tenant": "acme"}}
+
+	tests := []struct {
+		name      string
+		index     string
+		event     domain.MessageEvent
+		errorType string
+		wantIndex string
+	}{
+		{name: "tombstone without template fields", index: "events-{metadata.tenant}", event: tombstone, errorType: errorTypeIndexResolution},
+		{name: "delete carrying template fields", index: "events-{metadata.tenant}", event: routed, wantIndex: "events-acme"},
+		{name: "delete on date-based template", index: "events-{yyyy.MM}", event: tombstone, errorType: errorTypeUnsupportedOperation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, stub := newTestClient(t)
+			indexer, err := NewIndexer(client, tt.index)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			results, err := indexer.Index(context.Background(), []domain.MessageEvent{tt.event})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			actions := stub.recorded()
+			if tt.errorType != "" {
+				if results[0].Status != http.StatusBadRequest || results[0].ErrorType != tt.errorType {
+					t.Fatalf("expected delete to be rejected with %s, got %+v", tt.errorType, results[0])
+				}
+				if len(actions) != 0 {
+					t.Fatalf("expected no bulk actions, got %d", len(actions))
+				}
+				return
+			}
+			if len(actions) != 1 || actions[0].Type != "delete" || actions[0].Meta["_index"] != tt.wantIndex {
+				t.Fatalf("expected delete from %s, got %+v", tt.wantIndex, actions)
+			}
+		})
+	}
+}
+
+func TestIndexerOperations(t *testing.T) {
+	client, stub := newTestClient(t)
+	stub.status = func(a bulkAction) int {
+		if a.Meta["_id"] == "msg-gone" || a.Meta["_id"] == "msg-missing" {
+			return http.StatusNotFound
+		}
+		return http.StatusOK
+	}
+
+	indexer, err := NewIndexer(client, "messages")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	payload := map[string]any{"total": 42.0}
+	events := []domain.MessageEvent{
+		{ID: "msg-index", Payload: payload},
+		{ID: "msg-update", Payload: payload, Metadata: map[string]string{"op": "update"}},
+		{ID: "msg-upsert", Payload: payload, Metadata: map[string]string{"op": "upsert"}},
+		{ID: "msg-script", Payload: payload, Metadata: map[string]string{"op": "upsert", "script": "add-total"}},
+		{ID: "msg-gone", Metadata: map[string]string{"op": "delete"}},
+		{ID: "msg-missing", Payload: payload, Metadata: map[string]string{"op": "update"}},
+		{ID: "msg-unknown", Metadata: map[string]string{"op": "merge"}},
+		{Metadata: map[string]string{"op": "delete"}},
+	}
+
+	results, err := indexer.Index(context.Background(), events)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if got := results[4].Outcome(); got != ports.IndexOutcomeSucceeded {
+		t.Fatalf("expected delete of a missing document to succeed, got outcome %v", got)
+	}
+	if got := results[5].Outcome(); got != ports.IndexOutcomeRejected {
+		t.Fatalf("expected update of a missing document to be rejected, got outcome %v", got)
+	}
+	for _, idx := range []int{6, 7} {
+		if results[idx].Status != http.StatusBadRequest || results[idx].ErrorType != errorTypeUnsupportedOperation {
+			t.Fatalf("expected event %d to be rejected, got %+v", idx, results[idx])
+		}
+	}
+
+	actions := stub.recorded()
+	if len(actions) != 6 {
+		t.Fatalf("expected 6 bulk actions, got %d", len(actions))
+	}
+	wantTypes := []string{"index", "update", "update", "update", "delete", "update"}
+	for k, a := range actions {
+		if a.Type != wantTypes[k] {
+			t.Fatalf("action %d: expected %s, got %s", k, wantTypes[k], a.Type)
+		}
+	}
+
+	if a := actions[0]; a.Doc["id"] != "msg-index" {
+		t.Fatalf("expected index action to carry the event, got %v", a.Doc)
+	}
+	if a := actions[1]; a.Doc["doc_as_upsert"] != false || a.Doc["doc"].(map[string]any)["id"] != "msg-update" {
+		t.Fatalf("expected partial doc update, got %v", a.Doc)
+	}
+	if a := actions[2]; a.Doc["doc_as_upsert"] != true {
+		t.Fatalf("expected doc_as_upsert, got %v", a.Doc)
+	}
+	script, ok := actions[3].Doc["script"].(map[string]any)
+	if !ok || script["id"] != "add-total" || script["params"].(map[string]any)["total"] != 42.0 {
+		t.Fatalf("expected stored script with payload params, got %v", actions[3].Doc)
+	}
+	if upsert, ok := actions[3].Doc["upsert"].(map[string]any); !ok || upsert["id"] != "msg-script" {
+		t.Fatalf("expected scripted upsert to carry the event, got %v", actions[3].Doc)
+	}
+	if actions[4].Doc != nil {
+		t.Fatalf("expected delete action without a document, got %v", actions[4].Doc)
+	}
+}
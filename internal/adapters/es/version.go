@@ -0,0 +1,95 @@
+package es
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+)
+
+// VersionType selects how Elasticsearch compares the external version of a
+// write with the version of the stored document.
+type VersionType string
+
+// Supported external version types. VersionExternal applies a write only if
+// its version is greater than the stored one; VersionExternalGTE also applies
+// equal versions, so a redelivered event rewrites its own document.
+const (
+	VersionExternal    VersionType = "external"
+	VersionExternalGTE VersionType = "external_gte"
+)
+
+// ParseVersionType validates s as an external version type.
+func ParseVersionType(s string) (VersionType, error) {
+	switch v := VersionType(s); v {
+	case VersionExternal, VersionExternalGTE:
+		return v, nil
+	default:
+		return "", fmt.Errorf("invalid version type %q: must be one of external, external_gte", s)
+	}
+}
+
+// versionSource locates the external version of an event: either a metadata
+// entry or a payload field, with dots descending into nested objects.
+type versionSource struct {
+	metadataKey string
+	payloadPath []string
+}
+
+// parseVersionSource parses "metadata.<key>" or "payload.<path>", the same
+// field references accepted by index templates.
+func parseVersionSource(s string) (versionSource, error) {
+	part, err := parsePlaceholder(s)
+	if err != nil || part.dateLayout != "" {
+		return versionSource{}, fmt.Errorf("invalid version source %q: must be metadata.<key> or payload.<path>", s)
+	}
+	return versionSource{metadataKey: part.metadataKey, payloadPath: part.payloadPath}, nil
+}
+
+// resolve returns the version of evt. Values are non-negative integers, or
+// RFC 3339 timestamps converted to epoch milliseconds.
+func (v versionSource) resolve(evt domain.MessageEvent) (int64, error) {
+	if v.metadataKey != "" {
+		raw, ok := evt.Metadata[v.metadataKey]
+		if !ok || raw == "" {
+			return 0, fmt.Errorf("metadata field %q is missing", v.metadataKey)
+		}
+		return parseVersion(raw)
+	}
+
+	// JSON numbers decode as float64; read them directly so large integers
+	// are not formatted in exponent notation.
+	field := strings.Join(v.payloadPath, ".")
+	raw, err := payloadField(evt.Payload, v.payloadPath)
+	if err != nil {
+		return 0, err
+	}
+	switch raw := raw.(type) {
+	case float64:
+		// float64(math.MaxInt64) rounds up to 2^63, which overflows int64.
+		if raw < 0 || raw != math.Trunc(raw) || raw >= math.MaxInt64 {
+			return 0, fmt.Errorf("payload field %q is not a non-negative integer", field)
+		}
+		return int64(raw), nil
+	case string:
+		return parseVersion(raw)
+	default:
+		return 0, fmt.Errorf("payload field %q is neither a number nor a string", field)
+	}
+}
+
+func parseVersion(raw string) (int64, error) {
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("version %d is negative", n)
+		}
+		return n, nil
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return ts.UnixMilli(), nil
+	}
+	return 0, fmt.Errorf("version %q is neither an integer nor an RFC 3339 timestamp", raw)
+}
@@ -0,0 +1,200 @@
+package es
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+func TestVersionSourceResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		evt     domain.MessageEvent
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:   "metadata integer",
+			source: "metadata.kafka.offset",
+			evt:    domain.MessageEvent{Metadata: map[string]string{"kafka.offset": "1042"}},
+			want:   1042,
+		},
+		{
+			name:   "metadata timestamp",
+			source: "metadata.updated_at",
+			evt:    domain.MessageEvent{Metadata: map[string]string{"updated_at": "2024-03-09T12:00:00.5Z"}},
+			want:   1709985600500,
+		},
+		{
+			name:   "payload number",
+			source: "payload.order.revision",
+			evt:    domain.MessageEvent{Payload: map[string]any{"order": map[string]any{"revision": 1e12}}},
+			want:   1e12,
+		},
+		{
+			name:    "missing metadata",
+			source:  "metadata.updated_at",
+			evt:     domain.MessageEvent{},
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			source:  "metadata.version",
+			evt:     domain.MessageEvent{Metadata: map[string]string{"version": "-1"}},
+			wantErr: true,
+		},
+		{
+			name:    "fractional payload number",
+			source:  "payload.revision",
+			evt:     domain.MessageEvent{Payload: map[string]any{"revision": 1.5}},
+			wantErr: true,
+		},
+		{
+			name:    "payload number overflowing int64",
+			source:  "payload.revision",
+			evt:     domain.MessageEvent{Payload: map[string]any{"revision": float64(1 << 63)}},
+			wantErr: true,
+		},
+		{
+			name:    "missing payload field",
+			source:  "payload.order.revision",
+			evt:     domain.MessageEvent{Payload: map[string]any{"order": "shipped"}},
+			wantErr: true,
+		},
+		{
+			name:    "payload object",
+			source:  "payload.order",
+			evt:     domain.MessageEvent{Payload: map[string]any{"order": map[string]any{}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := parseVersionSource(tt.source)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			got, err := src.resolve(tt.evt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("resolve() = %d, expected %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewIndexerValidatesExternalVersion(t *testing.T) {
+	client, _ := newTestClient(t)
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "unknown version type", opts: []Option{WithExternalVersion("internal", "metadata.version")}},
+		{name: "unknown source", opts: []Option{WithExternalVersion(VersionExternal, "offset")}},
+		{name: "empty metadata key", opts: []Option{WithExternalVersion(VersionExternal, "metadata.")}},
+		{name: "data stream", opts: []Option{WithExternalVersion(VersionExternal, "metadata.version"), WithDataStream("timestamp")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewIndexer(client, "messages", tt.opts...); err == nil {
+				t.Fatal("expected error for invalid versioning options")
+			}
+		})
+	}
+}
+
+func TestIndexerExternalVersion(t *testing.T) {
+	client, stub := newTestClient(t)
+	stub.status = func(a bulkAction) int {
+		if a.Meta["_id"] == "msg-stale" {
+			return http.StatusConflict
+		}
+		return http.StatusCreated
+	}
+
+	indexer, err := NewIndexer(client, "messages", WithExternalVersion(VersionExternalGTE, "metadata.version"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	events := []domain.MessageEvent{
+		{ID: "msg-1", Metadata: map[string]string{"version": "7"}},
+		{ID: "msg-stale", Metadata: map[string]string{"version": "3"}},
+		{ID: "msg-unversioned"},
+		{ID: "msg-2", Metadata: map[string]string{"op": "delete", "version": "8"}},
+		{ID: "msg-3", Metadata: map[string]string{"op": "update"}},
+	}
+
+	results, err := indexer.Index(context.Background(), events)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := results[1].Outcome(); got != ports.IndexOutcomeSucceeded {
+		t.Fatalf("expected version conflict to count as success, got outcome %v", got)
+	}
+	if results[2].Status != http.StatusBadRequest || results[2].ErrorType != errorTypeVersionResolution {
+		t.Fatalf("expected unversioned event to be rejected, got %+v", results[2])
+	}
+
+	actions := stub.recorded()
+	if len(actions) != 4 {
+		t.Fatalf("expected 4 bulk actions, got %d", len(actions))
+	}
+	for k, want := range []float64{7, 3} {
+		if actions[k].Meta["version"] != want || actions[k].Meta["version_type"] != "external_gte" {
+			t.Fatalf("action %d: expected external_gte version %v, got %v", k, want, actions[k].Meta)
+		}
+	}
+	if actions[2].Type != "delete" || actions[2].Meta["version"] != 8.0 {
+		t.Fatalf("expected versioned delete, got %+v", actions[2])
+	}
+	if _, ok := actions[3].Meta["version"]; ok || actions[3].Type != "update" {
+		t.Fatalf("expected unversioned update, got %+v", actions[3])
+	}
+}
+
+func TestIndexerStripsTransientVersionMetadata(t *testing.T) {
+	client, stub := newTestClient(t)
+	indexer, err := NewIndexer(client, "messages",
+		WithExternalVersion(VersionExternal, "metadata.kafka.offset"),
+		WithTransientMetadata("kafka.offset"),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	metadata := map[string]string{"kafka.offset": "42", "tenant": "acme"}
+	events := []domain.MessageEvent{
+		{ID: "msg-1", Metadata: metadata},
+		{ID: "msg-2", Metadata: map[string]string{"kafka.offset": "43"}},
+	}
+	if _, err := indexer.Index(context.Background(), events); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	actions := stub.recorded()
+	if len(actions) != 2 {
+		t.Fatalf("expected 2 bulk actions, got %d", len(actions))
+	}
+	if actions[0].Meta["version"] != 42.0 || actions[1].Meta["version"] != 43.0 {
+		t.Fatalf("expected versions read from the offset, got %v and %v", actions[0].Meta, actions[1].Meta)
+	}
+	stored, _ := actions[0].Doc["metadata"].(map[string]any)
+	if _, ok := stored["kafka.offset"]; ok || stored["tenant"] != "acme" {
+		t.Fatalf("expected only the transient entry to be stripped, got %v", actions[0].Doc["metadata"])
+	}
+	if _, ok := actions[1].Doc["metadata"]; ok {
+		t.Fatalf("expected metadata to be omitted once emptied, got %v", actions[1].Doc["metadata"])
+	}
+	if metadata["kafka.offset"] != "42" {
+		t.Fatal("expected the event metadata to be left untouched")
+	}
+}
@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// commitTimeout bounds a single offset commit. Commits run detached from the
+// stream's context so that the final one survives its cancellation.
+const commitTimeout = 10 * time.Second
+
+// offsetCommitter commits the offsets of fetched messages. *kafkago.Reader
+// implements it.
+type offsetCommitter interface {
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
+}
+
+// committer commits the offsets acknowledged on one stream. Acknowledging a
+// message only advances the watermark of its partition; a single goroutine
+// commits the latest watermark of every partition that moved in one request.
+// Acknowledgements arriving while a commit is in flight are coalesced into
+// the next one, so settling a bulk batch costs a few broker round trips
+// rather than one per message.
+type committer struct {
+	reader  offsetCommitter
+	offsets *offsetTracker
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	pending map[topicPartition]int64
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newCommitter(reader offsetCommitter, logger *slog.Logger) *committer {
+	return &committer{
+		reader:  reader,
+		offsets: newOffsetTracker(),
+		logger:  logger,
+		pending: make(map[topicPartition]int64),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// track registers m before it is handed to the service.
+func (c *committer) track(m kafkago.Message) {
+	c.offsets.track(m.Topic, m.Partition, m.Offset)
+}
+
+// ack marks m as processed and schedules a commit if that moved the
+// watermark of its partition.
+func (c *committer) ack(m kafkago.Message) {
+	offset, ok := c.offsets.complete(m.Topic, m.Partition, m.Offset)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	c.pending[topicPartition{topic: m.Topic, partition: m.Partition}] = offset
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run commits the pending watermarks whenever acknowledgements move them,
+// until close is called, and then one last time.
+func (c *committer) run() {
+	defer close(c.done)
+	for {
+		select {
+		case <-c.wake:
+			c.commit()
+		case <-c.stop:
+			c.commit()
+			return
+		}
+	}
+}
+
+// close stops run and waits for its final commit.
+func (c *committer) close() {
+	close(c.stop)
+	<-c.done
+}
+
+// commit sends the pending watermarks in a single request. Watermarks that
+// fail to commit are retried with the next commit unless superseded.
+func (c *committer) commit() {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[topicPartition]int64)
+	c.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+
+	msgs := make([]kafkago.Message, 0, len(pending))
+	for tp, offset := range pending {
+		c.logger.DebugContext(ctx, "committing offset", "topic", tp.topic, "partition", tp.partition, "offset", offset)
+		msgs = append(msgs, kafkago.Message{Topic: tp.topic, Partition: tp.partition, Offset: offset})
+	}
+
+	if err := c.reader.CommitMessages(ctx, msgs...); err != nil {
+		c.logger.ErrorContext(ctx, "failed to commit offsets", "partitions", len(msgs), "error", err)
+
+		c.mu.Lock()
+		for tp, offset := range pending {
+			if _, superseded := c.pending[tp]; !superseded {
+				c.pending[tp] = offset
+			}
+		}
+		c.mu.Unlock()
+	}
+}
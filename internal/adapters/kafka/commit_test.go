@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"sync"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// fakeCommitter records every commit request.
+type fakeCommitter struct {
+	mu       sync.Mutex
+	err      error
+	requests [][]kafkago.Message
+}
+
+func (f *fakeCommitter) CommitMessages(_ context.Context, msgs ...kafkago.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, msgs)
+	return f.err
+}
+
+func (f *fakeCommitter) committed() map[topicPartition]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(map[topicPartition]int64)
+	for _, req := range f.requests {
+		for _, m := range req {
+			out[topicPartition{topic: m.Topic, partition: m.Partition}] = m.Offset
+		}
+	}
+	return out
+}
+
+func TestCommitter_CoalescesAcknowledgements(t *testing.T) {
+	reader := &fakeCommitter{}
+	c := newCommitter(reader, slog.New(slog.DiscardHandler))
+
+	var msgs []kafkago.Message
+	for partition := range 2 {
+		for offset := range int64(100) {
+			msgs = append(msgs, kafkago.Message{Topic: "messages", Partition: partition, Offset: offset})
+		}
+	}
+	for _, m := range msgs {
+		c.track(m)
+	}
+	for _, m := range msgs {
+		c.ack(m)
+	}
+
+	// Without run, acknowledgements only accumulate; close commits them in a
+	// single request.
+	go c.run()
+	c.close()
+
+	if len(reader.requests) != 1 {
+		t.Fatalf("expected 1 commit request, got %d", len(reader.requests))
+	}
+	want := map[topicPartition]int64{{"messages", 0}: 99, {"messages", 1}: 99}
+	if got := reader.committed(); !maps.Equal(got, want) {
+		t.Fatalf("expected commits %v, got %v", want, got)
+	}
+}
+
+func TestCommitter_CommitsOnlyContiguousOffsets(t *testing.T) {
+	reader := &fakeCommitter{}
+	c := newCommitter(reader, slog.New(slog.DiscardHandler))
+
+	for offset := range int64(3) {
+		c.track(kafkago.Message{Topic: "messages", Offset: offset})
+	}
+	c.ack(kafkago.Message{Topic: "messages", Offset: 1})
+	c.ack(kafkago.Message{Topic: "messages", Offset: 2})
+
+	go c.run()
+	c.close()
+
+	if len(reader.requests) != 0 {
+		t.Fatalf("expected no commit while offset 0 is in flight, got %v", reader.requests)
+	}
+}
+
+func TestCommitter_RetriesFailedCommit(t *testing.T) {
+	reader := &fakeCommitter{err: errors.New("coordinator not available")}
+	c := newCommitter(reader, slog.New(slog.DiscardHandler))
+
+	c.track(kafkago.Message{Topic: "messages", Offset: 7})
+	c.ack(kafkago.Message{Topic: "messages", Offset: 7})
+	c.commit()
+
+	reader.err = nil
+	c.commit()
+
+	if len(reader.requests) != 2 {
+		t.Fatalf("expected the failed commit to be retried, got %d requests", len(reader.requests))
+	}
+	if got := reader.committed()[topicPartition{"messages", 0}]; got != 7 {
+		t.Fatalf("expected offset 7 committed, got %d", got)
+	}
+}
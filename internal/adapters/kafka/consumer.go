@@ -6,6 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	kafkago "github.com/segmentio/kafka-go"
 
@@ -13,65 +18,410 @@ import (
 	"github.com/nimafallahian/go-workflow/internal/ports"
 )
 
+// defaultMaxBytes mirrors kafka-go's fetch size default. It is applied up
+// front so that a MinBytes option is validated against it.
+const defaultMaxBytes = 1e6
+
+// rebalanceCheckInterval is how often a stream checks whether its reader
+// rejoined the group, dropping the lag gauges of the previous assignment.
+const rebalanceCheckInterval = 5 * time.Second
+
+// defaultSessionTimeout and defaultHeartbeatInterval mirror kafka-go's group
+// defaults, against which the configured values are validated.
+const (
+	defaultSessionTimeout    = 30 * time.Second
+	defaultHeartbeatInterval = 3 * time.Second
+)
+
 // Consumer implements ports.MessageConsumer using segmentio/kafka-go.
 type Consumer struct {
-	reader *kafkago.Reader
+	readerConfig kafkago.ReaderConfig
+	brokers      []string
+	subscription Subscription
+	metrics      ports.Metrics
+	logger       *slog.Logger
+
+	// statusHeader, if set, names the header carrying the event status;
+	// statusPrecedence decides whether it overrides the payload.
+	statusHeader     string
+	statusPrecedence StatusPrecedence
+
+	// isolationLevel is mapped onto readerConfig by NewConsumer.
+	isolationLevel IsolationLevel
+
+	// startOffset applies to partitions without a committed offset.
+	startOffset StartOffset
+
+	// transport carries the broker security settings for requests made
+	// outside the reader, such as replay commits.
+	transport *kafkago.Transport
+
+	// streams counts the running streams, which commit their acknowledged
+	// offsets one last time on the way out. closing ends them on Close.
+	streams   sync.WaitGroup
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// Option configures a Consumer.
+type Option func(*Consumer)
+
+// WithMetrics records consumption metrics on m.
+func WithMetrics(m ports.Metrics) Option {
+	return func(c *Consumer) {
+		c.metrics = m
+	}
+}
+
+// WithLogger sets the logger used by the consumer.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Consumer) {
+		c.logger = l
+	}
+}
+
+// kafkaLoggers adapts l to the loggers of a kafka-go reader or writer: the
+// chatty client logs at debug level and client errors at error level, so they
+// honour the runtime log level like the rest of the service.
+func kafkaLoggers(l *slog.Logger) (kafkago.Logger, kafkago.Logger) {
+	logf := func(level slog.Level) kafkago.LoggerFunc {
+		return func(format string, args ...any) {
+			if l.Enabled(context.Background(), level) {
+				l.Log(context.Background(), level, fmt.Sprintf(format, args...), "component", "kafka-go")
+			}
+		}
+	}
+	return logf(slog.LevelDebug), logf(slog.LevelError)
+}
+
+// WithMinBytes sets the minimum number of bytes a fetch waits for before the
+// broker answers, trading latency for fewer, larger fetches.
+func WithMinBytes(n int) Option {
+	return func(c *Consumer) {
+		c.readerConfig.MinBytes = n
+	}
+}
+
+// WithMaxBytes caps the number of bytes returned by a single fetch.
+func WithMaxBytes(n int) Option {
+	return func(c *Consumer) {
+		c.readerConfig.MaxBytes = n
+	}
+}
+
+// WithMaxWait bounds how long a fetch waits for MinBytes to accumulate.
+func WithMaxWait(d time.Duration) Option {
+	return func(c *Consumer) {
+		c.readerConfig.MaxWait = d
+	}
+}
+
+// WithSessionTimeout sets how long the group coordinator waits for a
+// heartbeat before evicting the consumer and rebalancing its partitions.
+func WithSessionTimeout(d time.Duration) Option {
+	return func(c *Consumer) {
+		c.readerConfig.SessionTimeout = d
+	}
+}
+
+// WithHeartbeatInterval sets how often the consumer heartbeats to the group
+// coordinator. It must be shorter than the session timeout.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(c *Consumer) {
+		c.readerConfig.HeartbeatInterval = d
+	}
+}
+
+// WithRebalanceTimeout sets how long the group coordinator waits for members
+// to rejoin during a rebalance.
+func WithRebalanceTimeout(d time.Duration) Option {
+	return func(c *Consumer) {
+		c.readerConfig.RebalanceTimeout = d
+	}
+}
+
+// IsolationLevel controls whether records of open or aborted transactions
+// are consumed.
+type IsolationLevel string
+
+// Supported isolation levels. ReadCommitted only returns records of
+// committed transactions, up to the last stable offset.
+const (
+	ReadUncommitted IsolationLevel = "read_uncommitted"
+	ReadCommitted   IsolationLevel = "read_committed"
+)
+
+// ParseIsolationLevel validates s as an isolation level.
+func ParseIsolationLevel(s string) (IsolationLevel, error) {
+	switch l := IsolationLevel(s); l {
+	case ReadUncommitted, ReadCommitted:
+		return l, nil
+	default:
+		return "", fmt.Errorf("invalid isolation level %q: must be one of read_uncommitted, read_committed", s)
+	}
 }
 
-// NewConsumer constructs a new Consumer configured for manual offset commits.
-func NewConsumer(brokers []string, topic, groupID string) (*Consumer, error) {
+// WithIsolationLevel sets the isolation level of fetches. The default is
+// ReadUncommitted.
+func WithIsolationLevel(l IsolationLevel) Option {
+	return func(c *Consumer) {
+		c.isolationLevel = l
+	}
+}
+
+// WithSecurity secures broker connections with the given TLS and SASL
+// settings.
+func WithSecurity(sec Security) Option {
+	return func(c *Consumer) {
+		c.readerConfig.Dialer = sec.dialer()
+		c.transport = sec.transport()
+	}
+}
+
+// NewConsumer constructs a new Consumer of the topics selected by sub, joined
+// to the consumer group groupID and configured for manual offset commits.
+func NewConsumer(brokers []string, sub Subscription, groupID string, opts ...Option) (*Consumer, error) {
 	if len(brokers) == 0 {
 		return nil, fmt.Errorf("brokers must not be empty")
 	}
-	if topic == "" {
-		return nil, fmt.Errorf("topic must not be empty")
+	if err := sub.validate(); err != nil {
+		return nil, err
 	}
 	if groupID == "" {
 		return nil, fmt.Errorf("groupID must not be empty")
 	}
 
-	reader := kafkago.NewReader(kafkago.ReaderConfig{
-		Brokers:        brokers,
-		Topic:          topic,
-		GroupID:        groupID,
-		CommitInterval: 0, // manual commits only
-	})
+	c := &Consumer{
+		readerConfig: kafkago.ReaderConfig{
+			Brokers:        brokers,
+			GroupTopics:    sub.Topics,
+			GroupID:        groupID,
+			CommitInterval: 0, // manual commits only
+		},
+		closing:        make(chan struct{}),
+		brokers:        brokers,
+		subscription:   sub,
+		startOffset:    StartEarliest,
+		isolationLevel: ReadUncommitted,
+		metrics:        ports.NopMetrics{},
+		logger:         slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.metrics == nil {
+		c.metrics = ports.NopMetrics{}
+	}
+	if c.logger == nil {
+		c.logger = slog.New(slog.DiscardHandler)
+	}
+
+	switch c.startOffset {
+	case StartEarliest:
+		c.readerConfig.StartOffset = kafkago.FirstOffset
+	case StartLatest:
+		c.readerConfig.StartOffset = kafkago.LastOffset
+	default:
+		_, err := ParseStartOffset(string(c.startOffset))
+		return nil, err
+	}
+	switch c.isolationLevel {
+	case ReadUncommitted:
+		c.readerConfig.IsolationLevel = kafkago.ReadUncommitted
+	case ReadCommitted:
+		c.readerConfig.IsolationLevel = kafkago.ReadCommitted
+	default:
+		_, err := ParseIsolationLevel(string(c.isolationLevel))
+		return nil, err
+	}
+	if err := validateGroupTimeouts(c.readerConfig); err != nil {
+		return nil, err
+	}
+	if c.statusHeader != "" {
+		if _, err := ParseStatusPrecedence(string(c.statusPrecedence)); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.readerConfig.Dialer == nil {
+		c.readerConfig.Dialer = Security{}.dialer()
+		c.transport = Security{}.transport()
+	}
+	if c.readerConfig.MaxBytes == 0 {
+		c.readerConfig.MaxBytes = defaultMaxBytes
+	}
+	c.readerConfig.Logger, c.readerConfig.ErrorLogger = kafkaLoggers(c.logger)
+
+	// NewReader panics on an invalid config; surface it as an error instead.
+	// The topics of a pattern subscription are only known once resolved, so
+	// validate the rest of the config with a stand-in.
+	validated := c.readerConfig
+	if sub.Pattern != nil {
+		validated.GroupTopics = []string{"pattern"}
+	}
+	if err := validated.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid reader config: %w", err)
+	}
+
+	return c, nil
+}
+
+// validateGroupTimeouts checks the fetch wait and group membership timeouts,
+// which kafka-go leaves to the broker, with kafka-go's defaults for those
+// left unset.
+func validateGroupTimeouts(cfg kafkago.ReaderConfig) error {
+	timeouts := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"max wait", cfg.MaxWait},
+		{"session timeout", cfg.SessionTimeout},
+		{"heartbeat interval", cfg.HeartbeatInterval},
+		{"rebalance timeout", cfg.RebalanceTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d < 0 {
+			return fmt.Errorf("%s must not be negative, got %v", t.name, t.d)
+		}
+	}
 
-	return &Consumer{reader: reader}, nil
+	session, heartbeat := cfg.SessionTimeout, cfg.HeartbeatInterval
+	if session == 0 {
+		session = defaultSessionTimeout
+	}
+	if heartbeat == 0 {
+		heartbeat = defaultHeartbeatInterval
+	}
+	if heartbeat >= session {
+		return fmt.Errorf("heartbeat interval %v must be shorter than session timeout %v", heartbeat, session)
+	}
+	return nil
 }
 
 // Stream starts a goroutine that continuously reads from Kafka and pushes
 // domain-mapped messages onto a channel until the context is cancelled.
+//
+// Each Stream joins the group with a new reader, which leaves the group as
+// soon as the stream ends, so messages fetched by a previous stream but never
+// committed are delivered again. Messages must be
+// acknowledged before ctx is cancelled: the stream commits their offsets
+// asynchronously and one last time once ctx is done.
+//
+// For a pattern subscription, the stream ends with a transient error once
+// the matching topics change, so that the caller drains in-flight messages
+// before the next Stream rejoins the group with the new topics.
 func (c *Consumer) Stream(ctx context.Context) (<-chan ports.KafkaMessage, <-chan error) {
 	msgCh := make(chan ports.KafkaMessage)
 	errCh := make(chan error, 1)
 
+	c.streams.Add(1)
 	go func() {
+		defer c.streams.Done()
 		defer close(msgCh)
 		defer close(errCh)
 
+		// Close ends the stream like cancelling ctx does.
+		ctx, end := context.WithCancel(ctx)
+		defer end()
+		go func() {
+			select {
+			case <-c.closing:
+				end()
+			case <-ctx.Done():
+			}
+		}()
+
+		reader, topics, err := c.subscribe(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			err = classifyError(err)
+			c.logger.ErrorContext(ctx, "kafka subscribe failed", "subscription", c.subscription.String(), "error", err)
+			errCh <- err
+			return
+		}
+
+		defer func() {
+			if err := reader.Close(); err != nil {
+				c.logger.WarnContext(ctx, "failed to close kafka reader", "error", err)
+			}
+		}()
+
+		commits := newCommitter(reader, c.logger)
+		go commits.run()
+		defer commits.close()
+
+		// The reader leaves the group when the stream ends, revoking all its
+		// partitions.
+		lag := newLagGauges(c.metrics)
+		defer lag.revoke()
+
+		fetchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go watchRebalances(fetchCtx, reader, lag)
+
+		var changed atomic.Bool
+		if c.subscription.Pattern != nil {
+			go c.watchTopics(fetchCtx, topics, func() {
+				changed.Store(true)
+				cancel()
+			})
+		}
+
 		for {
-			m, err := c.reader.FetchMessage(ctx)
+			m, err := reader.FetchMessage(fetchCtx)
 			if err != nil {
+				if changed.Load() && ctx.Err() == nil {
+					errCh <- errSubscriptionChanged
+					return
+				}
 				if errors.Is(err, context.Canceled) || errors.Is(err, io.EOF) {
 					return
 				}
+				err = classifyError(err)
+				c.logger.ErrorContext(ctx, "kafka fetch failed", "subscription", c.subscription.String(), "error", err)
 				errCh <- err
 				return
 			}
 
-			var event domain.MessageEvent
-			if err := json.Unmarshal(m.Value, &event); err != nil {
-				errCh <- err
-				return
+			commits.track(m)
+			lag.report(m.Topic, m.Partition, max(m.HighWaterMark-m.Offset-1, 0))
+
+			// Undecodable records are surfaced as poison messages rather than
+			// terminating the stream, so the service can dead-letter them.
+			event, err := decodeEvent(m)
+			if err == nil {
+				event.StatusCode, err = c.eventStatus(event.StatusCode, m.Headers)
 			}
+			var poison *ports.PoisonError
+			if err != nil {
+				poison = &ports.PoisonError{Err: err}
+				event = domain.MessageEvent{}
+			}
+			c.metrics.MessageConsumed(event.StatusCategory())
 
 			kmsg := ports.KafkaMessage{
-				Event: event,
-				Commit: func(commitCtx context.Context) error {
-					return c.reader.CommitMessages(commitCtx, m)
+				Event:     event,
+				Poison:    poison,
+				Value:     m.Value,
+				Key:       m.Key,
+				Topic:     m.Topic,
+				Partition: m.Partition,
+				Offset:    m.Offset,
+				Timestamp: m.Time,
+				Headers:   portHeaders(m.Headers),
+				Commit: func(context.Context) error {
+					commits.ack(m)
+					return nil
 				},
 			}
+			if poison != nil {
+				c.logger.LogAttrs(ctx, slog.LevelWarn, "undecodable kafka message",
+					append(kmsg.LogAttrs(), slog.Any("error", poison.Err))...)
+			} else {
+				c.logger.LogAttrs(ctx, slog.LevelDebug, "kafka message received", kmsg.LogAttrs()...)
+			}
 
 			select {
 			case <-ctx.Done():
@@ -84,6 +434,83 @@ func (c *Consumer) Stream(ctx context.Context) (<-chan ports.KafkaMessage, <-cha
 	return msgCh, errCh
 }
 
+// watchRebalances samples the reader's statistics every
+// rebalanceCheckInterval until ctx is done. kafka-go rebalances eagerly:
+// every new generation revokes the previous assignment, so the lag it
+// reported is dropped. Sampling rather than checking every message keeps
+// the snapshot, which resets the reader's counters, off the fetch path.
+func watchRebalances(ctx context.Context, reader *kafkago.Reader, lag *lagGauges) {
+	ticker := time.NewTicker(rebalanceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if reader.Stats().Rebalances > 0 {
+			lag.revoke()
+		}
+	}
+}
+
+// decodeEvent decodes the record value into a domain event. A tombstone, a
+// record without a value, becomes a delete of the document whose ID is the
+// record key.
+func decodeEvent(m kafkago.Message) (domain.MessageEvent, error) {
+	if len(m.Value) == 0 {
+		if len(m.Key) == 0 {
+			return domain.MessageEvent{}, errors.New("tombstone without a key")
+		}
+		return domain.MessageEvent{
+			ID:       string(m.Key),
+			Metadata: map[string]string{domain.MetadataOperation: string(domain.OperationDelete)},
+		}, nil
+	}
+
+	var event domain.MessageEvent
+	if err := json.Unmarshal(m.Value, &event); err != nil {
+		return domain.MessageEvent{}, fmt.Errorf("decode message event: %w", err)
+	}
+	return event, nil
+}
+
+// portHeaders converts kafka-go record headers into their port type.
+func portHeaders(headers []kafkago.Header) []ports.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make([]ports.Header, len(headers))
+	for i, h := range headers {
+		out[i] = ports.Header{Key: h.Key, Value: h.Value}
+	}
+	return out
+}
+
+// fatalErrors lists broker error codes that restarting the consumer cannot
+// recover from without operator intervention.
+var fatalErrors = map[kafkago.Error]bool{
+	kafkago.InvalidTopic:               true,
+	kafkago.InvalidGroupId:             true,
+	kafkago.TopicAuthorizationFailed:   true,
+	kafkago.GroupAuthorizationFailed:   true,
+	kafkago.ClusterAuthorizationFailed: true,
+	kafkago.UnsupportedSASLMechanism:   true,
+	kafkago.IllegalSASLState:           true,
+	kafkago.UnsupportedVersion:         true,
+	kafkago.SASLAuthenticationFailed:   true,
+}
+
+// classifyError wraps unrecoverable broker errors with ports.ErrConsumerFatal.
+func classifyError(err error) error {
+	var kerr kafkago.Error
+	if errors.As(err, &kerr) && fatalErrors[kerr] {
+		return fmt.Errorf("%w: %w", ports.ErrConsumerFatal, err)
+	}
+	return err
+}
+
 // Consume satisfies the ports.MessageConsumer interface by delegating to Stream.
 func (c *Consumer) Consume(ctx context.Context) (<-chan ports.KafkaMessage, <-chan error) {
 	return c.Stream(ctx)
@@ -98,8 +525,62 @@ func (c *Consumer) Acknowledge(ctx context.Context, msg ports.KafkaMessage) erro
 	return msg.Commit(ctx)
 }
 
-// Close releases the underlying reader resources.
-func (c *Consumer) Close() error {
-	return c.reader.Close()
+// HealthCheck implements ports.HealthChecker by fetching the partition
+// metadata of the subscribed topics from the first reachable broker. For a
+// pattern subscription, reading the cluster metadata is enough.
+func (c *Consumer) HealthCheck(ctx context.Context) error {
+	partitions, err := c.readPartitions(ctx, c.subscription.Topics...)
+	if err != nil {
+		return err
+	}
+	for _, topic := range c.subscription.Topics {
+		if !slices.ContainsFunc(partitions, func(p kafkago.Partition) bool { return p.Topic == topic }) {
+			return fmt.Errorf("topic %s has no partitions", topic)
+		}
+	}
+	return nil
 }
 
+// readPartitions fetches the partition metadata of topics, or of every topic
+// if none are given, from the first reachable broker.
+func (c *Consumer) readPartitions(ctx context.Context, topics ...string) ([]kafkago.Partition, error) {
+	var errs []error
+	for _, broker := range c.brokers {
+		partitions, err := c.readBrokerPartitions(ctx, broker, topics)
+		if err == nil {
+			return partitions, nil
+		}
+		errs = append(errs, fmt.Errorf("broker %s: %w", broker, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *Consumer) readBrokerPartitions(ctx context.Context, broker string, topics []string) ([]kafkago.Partition, error) {
+	conn, err := c.readerConfig.Dialer.DialContext(ctx, "tcp", broker)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	partitions, err := conn.ReadPartitions(topics...)
+	if err != nil {
+		return nil, fmt.Errorf("read partitions: %w", err)
+	}
+	return partitions, nil
+}
+
+// Close ends every stream and waits for their final commits, after which
+// their readers have left the group.
+func (c *Consumer) Close() error {
+	c.closeOnce.Do(func() { close(c.closing) })
+	c.streams.Wait()
+	return nil
+}
@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		fatal bool
+	}{
+		{name: "authentication failure is fatal", err: kafkago.SASLAuthenticationFailed, fatal: true},
+		{name: "wrapped authorisation failure is fatal", err: fmt.Errorf("fetch: %w", kafkago.TopicAuthorizationFailed), fatal: true},
+		{name: "leader election is transient", err: kafkago.LeaderNotAvailable, fatal: false},
+		{name: "network error is transient", err: io.ErrUnexpectedEOF, fatal: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyError(tt.err)
+			if errors.Is(got, ports.ErrConsumerFatal) != tt.fatal {
+				t.Fatalf("classifyError(%v) fatal = %v, expected %v", tt.err, !tt.fatal, tt.fatal)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Fatalf("classifyError(%v) lost the original error", tt.err)
+			}
+		})
+	}
+}
+
+func TestNewConsumerValidatesFetchOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "negative min bytes", opts: []Option{WithMinBytes(-1)}},
+		{name: "min bytes above default max bytes", opts: []Option{WithMinBytes(2e6)}},
+		{name: "min bytes above max bytes", opts: []Option{WithMinBytes(1024), WithMaxBytes(512)}},
+		{name: "negative max wait", opts: []Option{WithMaxWait(-time.Second)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewConsumer([]string{"localhost:9092"}, Topics("messages"), "indexer-group", tt.opts...); err == nil {
+				t.Fatal("expected error for invalid fetch options")
+			}
+		})
+	}
+}
+
+func TestNewConsumerGroupOptions(t *testing.T) {
+	c, err := NewConsumer([]string{"localhost:9092"}, Topics("messages"), "indexer-group",
+		WithSessionTimeout(45*time.Second),
+		WithHeartbeatInterval(5*time.Second),
+		WithRebalanceTimeout(time.Minute),
+		WithIsolationLevel(ReadCommitted),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cfg := c.readerConfig
+	if cfg.SessionTimeout != 45*time.Second || cfg.HeartbeatInterval != 5*time.Second || cfg.RebalanceTimeout != time.Minute {
+		t.Fatalf("unexpected group timeouts %v/%v/%v", cfg.SessionTimeout, cfg.HeartbeatInterval, cfg.RebalanceTimeout)
+	}
+	if cfg.IsolationLevel != kafkago.ReadCommitted {
+		t.Fatalf("expected read committed isolation, got %v", cfg.IsolationLevel)
+	}
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "unknown isolation level", opts: []Option{WithIsolationLevel("serializable")}},
+		{name: "negative session timeout", opts: []Option{WithSessionTimeout(-time.Second)}},
+		{name: "heartbeat above default session timeout", opts: []Option{WithHeartbeatInterval(time.Minute)}},
+		{name: "heartbeat equal to session timeout", opts: []Option{WithSessionTimeout(10 * time.Second), WithHeartbeatInterval(10 * time.Second)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewConsumer([]string{"localhost:9092"}, Topics("messages"), "indexer-group", tt.opts...); err == nil {
+				t.Fatal("expected error for invalid group options")
+			}
+		})
+	}
+}
+
+func TestNewConsumerRoutesClientLogs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	c, err := NewConsumer([]string{"localhost:9092"}, Topics("messages"), "indexer-group", WithLogger(logger))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	c.readerConfig.Logger.Printf("fetched %d messages", 3)
+	if buf.Len() != 0 {
+		t.Fatalf("expected client debug logs to honour the level, got %s", buf.String())
+	}
+	c.readerConfig.ErrorLogger.Printf("broker %s unreachable", "b1")
+	if !strings.Contains(buf.String(), `"level":"ERROR","msg":"broker b1 unreachable","component":"kafka-go"`) {
+		t.Fatalf("expected client error log, got %s", buf.String())
+	}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	event, err := decodeEvent(kafkago.Message{Value: []byte(`{"id":"msg-1","payload":{"a":1},"status_code":200}`)})
+	if err != nil || event.ID != "msg-1" || event.Operation() != domain.OperationIndex {
+		t.Fatalf("expected decoded index event, got %+v, %v", event, err)
+	}
+
+	event, err = decodeEvent(kafkago.Message{Key: []byte("msg-2")})
+	if err != nil || event.ID != "msg-2" || event.Operation() != domain.OperationDelete {
+		t.Fatalf("expected tombstone to become a delete, got %+v, %v", event, err)
+	}
+
+	if _, err := decodeEvent(kafkago.Message{}); err == nil {
+		t.Fatal("expected error for tombstone without a key")
+	}
+	if _, err := decodeEvent(kafkago.Message{Value: []byte("not-json")}); err == nil {
+		t.Fatal("expected error for undecodable value")
+	}
+}
+
+func TestStreamEndsOnClose(t *testing.T) {
+	c, err := NewConsumer([]string{"localhost:9092"}, Topics("messages"), "indexer-group")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	msgCh, errCh := c.Stream(context.Background())
+
+	closed := make(chan error, 1)
+	go func() { closed <- c.Close() }()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for Close to end the stream")
+	}
+
+	// Both channels are closed once the stream has ended and left the group.
+	if _, ok := <-msgCh; ok {
+		t.Fatal("expected the message channel to be closed")
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("expected no stream error, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+// Header keys attached to every dead-lettered record.
+const (
+	HeaderDLQReason          = "x-dlq-reason"
+	HeaderDLQStatusCode      = "x-dlq-status-code"
+	HeaderDLQSourceTopic     = "x-dlq-source-topic"
+	HeaderDLQSourcePartition = "x-dlq-source-partition"
+	HeaderDLQSourceOffset    = "x-dlq-source-offset"
+	HeaderDLQAttempts        = "x-dlq-attempts"
+
+	// headerDLQPrefix is shared by every DLQ header key.
+	headerDLQPrefix = "x-dlq-"
+)
+
+// deadLetterBatchTimeout bounds how long a Publish waits for other dead
+// letters to share its produce request. kafka-go's default of one second
+// would stall the publishing worker for that long on every dead letter.
+const deadLetterBatchTimeout = 5 * time.Millisecond
+
+// DeadLetterProducer implements ports.DeadLetterPublisher using a kafka-go Writer.
+type DeadLetterProducer struct {
+	writer *kafkago.Writer
+}
+
+// DeadLetterOption configures a DeadLetterProducer.
+type DeadLetterOption func(*DeadLetterProducer)
+
+// WithDeadLetterSecurity secures broker connections with the given TLS and
+// SASL settings.
+func WithDeadLetterSecurity(sec Security) DeadLetterOption {
+	return func(p *DeadLetterProducer) {
+		p.writer.Transport = sec.transport()
+	}
+}
+
+// WithDeadLetterLogger routes the producer's client logs to l.
+func WithDeadLetterLogger(l *slog.Logger) DeadLetterOption {
+	return func(p *DeadLetterProducer) {
+		p.writer.Logger, p.writer.ErrorLogger = kafkaLoggers(l)
+	}
+}
+
+// NewDeadLetterProducer constructs a new DeadLetterProducer writing to topic.
+func NewDeadLetterProducer(brokers []string, topic string, opts ...DeadLetterOption) (*DeadLetterProducer, error) {
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("brokers must not be empty")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("topic must not be empty")
+	}
+
+	p := &DeadLetterProducer{
+		writer: &kafkago.Writer{
+			Addr:         kafkago.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafkago.Hash{},
+			RequiredAcks: kafkago.RequireAll,
+			BatchTimeout: deadLetterBatchTimeout,
+		},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p, nil
+}
+
+// Publish synchronously writes the original record key, bytes and headers to
+// the DLQ topic, adding the rejection reason and source coordinates as
+// headers.
+func (p *DeadLetterProducer) Publish(ctx context.Context, dl ports.DeadLetter) error {
+	msg := kafkago.Message{
+		Key:     dl.Key,
+		Value:   dl.Value,
+		Headers: deadLetterHeaders(dl),
+	}
+
+	if err := p.writer.WriteMessages(ctx, msg); err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending writes and releases the underlying writer resources.
+func (p *DeadLetterProducer) Close() error {
+	return p.writer.Close()
+}
+
+// deadLetterHeaders returns the original record headers followed by the DLQ
+// headers. DLQ headers left on a record that is dead-lettered again, e.g.
+// after a replay from the DLQ, are replaced rather than repeated.
+func deadLetterHeaders(dl ports.DeadLetter) []kafkago.Header {
+	headers := make([]kafkago.Header, 0, len(dl.Headers)+6)
+	for _, h := range dl.Headers {
+		if strings.HasPrefix(h.Key, headerDLQPrefix) {
+			continue
+		}
+		headers = append(headers, kafkago.Header{Key: h.Key, Value: h.Value})
+	}
+	return append(headers,
+		kafkago.Header{Key: HeaderDLQReason, Value: []byte(dl.Reason)},
+		kafkago.Header{Key: HeaderDLQStatusCode, Value: []byte(strconv.Itoa(dl.StatusCode))},
+		kafkago.Header{Key: HeaderDLQSourceTopic, Value: []byte(dl.Topic)},
+		kafkago.Header{Key: HeaderDLQSourcePartition, Value: []byte(strconv.Itoa(dl.Partition))},
+		kafkago.Header{Key: HeaderDLQSourceOffset, Value: []byte(strconv.FormatInt(dl.Offset, 10))},
+		kafkago.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(dl.Attempts))},
+	)
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+func TestDeadLetterHeaders(t *testing.T) {
+	headers := deadLetterHeaders(ports.DeadLetter{
+		Reason:     "rejected: 400 mapper_parsing_exception",
+		StatusCode: 200,
+		Topic:      "messages",
+		Partition:  2,
+		Offset:     17,
+		Attempts:   1,
+		Headers: []ports.Header{
+			{Key: "trace-id", Value: []byte("abc")},
+			{Key: HeaderDLQReason, Value: []byte("an earlier rejection")},
+		},
+	})
+
+	want := []kafkago.Header{
+		{Key: "trace-id", Value: []byte("abc")},
+		{Key: HeaderDLQReason, Value: []byte("rejected: 400 mapper_parsing_exception")},
+		{Key: HeaderDLQStatusCode, Value: []byte("200")},
+		{Key: HeaderDLQSourceTopic, Value: []byte("messages")},
+		{Key: HeaderDLQSourcePartition, Value: []byte("2")},
+		{Key: HeaderDLQSourceOffset, Value: []byte("17")},
+		{Key: HeaderDLQAttempts, Value: []byte("1")},
+	}
+	if len(headers) != len(want) {
+		t.Fatalf("expected %d headers, got %d: %v", len(want), len(headers), headers)
+	}
+	for i, h := range headers {
+		if h.Key != want[i].Key || string(h.Value) != string(want[i].Value) {
+			t.Fatalf("header %d: expected %s=%s, got %s=%s", i, want[i].Key, want[i].Value, h.Key, h.Value)
+		}
+	}
+}
+
+// stubBroker is a kafka-go transport answering metadata and produce requests
+// for a single-partition topic, so that writers can run without a broker.
+type stubBroker struct {
+	topic string
+}
+
+func (b stubBroker) RoundTrip(_ context.Context, _ net.Addr, req protocol.Message) (protocol.Message, error) {
+	switch req.(type) {
+	case *metadata.Request:
+		return &metadata.Response{
+			Brokers: []metadata.ResponseBroker{{NodeID: 1, Host: "localhost", Port: 9092}},
+			Topics: []metadata.ResponseTopic{{
+				Name:       b.topic,
+				Partitions: []metadata.ResponsePartition{{PartitionIndex: 0, LeaderID: 1}},
+			}},
+		}, nil
+	case *produce.Request:
+		return &produce.Response{
+			Topics: []produce.ResponseTopic{{
+				Topic:      b.topic,
+				Partitions: []produce.ResponsePartition{{Partition: 0}},
+			}},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected request %T", req)
+	}
+}
+
+func TestDeadLetterPublishDoesNotWaitForBatch(t *testing.T) {
+	p, err := NewDeadLetterProducer([]string{"localhost:9092"}, "messages-dlq")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.writer.Transport = stubBroker{topic: "messages-dlq"}
+	defer func() { _ = p.Close() }()
+
+	// Each dead letter is published synchronously by a worker, so a single
+	// write must not sit out a batch timeout waiting for company.
+	start := time.Now()
+	for i := range 3 {
+		if err := p.Publish(context.Background(), ports.DeadLetter{Value: []byte("{}"), Offset: int64(i)}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if took := time.Since(start); took > 300*time.Millisecond {
+		t.Fatalf("expected three dead letters to publish promptly, took %v", took)
+	}
+}
@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// partitionOffsets holds the in-flight offsets of one partition in fetch
+// order, along with whether each of them has completed processing.
+type partitionOffsets struct {
+	inflight  []int64
+	completed map[int64]bool
+}
+
+// offsetTracker records fetched offsets per partition so that only the
+// highest contiguous completed offset is ever committed. This prevents a
+// later offset from being committed while an earlier one on the same
+// partition is still in flight or has failed.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[topicPartition]*partitionOffsets
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[topicPartition]*partitionOffsets)}
+}
+
+// track registers a freshly fetched offset. Fetching an offset at or below
+// one already tracked means the partition was rewound (e.g. after a
+// rebalance), so its previous state is discarded.
+func (t *offsetTracker) track(topic string, partition int, offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := topicPartition{topic: topic, partition: partition}
+	p, ok := t.partitions[key]
+	if !ok || (len(p.inflight) > 0 && offset <= p.inflight[len(p.inflight)-1]) {
+		p = &partitionOffsets{completed: make(map[int64]bool)}
+		t.partitions[key] = p
+	}
+	p.inflight = append(p.inflight, offset)
+	p.completed[offset] = false
+}
+
+// complete marks offset as processed and returns the highest offset whose
+// predecessors have all completed. ok is false when the commit watermark did
+// not move.
+func (t *offsetTracker) complete(topic string, partition int, offset int64) (commit int64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, found := t.partitions[topicPartition{topic: topic, partition: partition}]
+	if !found {
+		return 0, false
+	}
+	if _, tracked := p.completed[offset]; !tracked {
+		// Stale completion from before a rewind.
+		return 0, false
+	}
+	p.completed[offset] = true
+
+	for len(p.inflight) > 0 && p.completed[p.inflight[0]] {
+		commit, ok = p.inflight[0], true
+		delete(p.completed, p.inflight[0])
+		p.inflight = p.inflight[1:]
+	}
+	return commit, ok
+}
+
+// lagGauges reports the consumer lag of the partitions fetched by one stream
+// and remembers them, so that their gauges can be dropped once revoked.
+type lagGauges struct {
+	metrics ports.Metrics
+
+	mu         sync.Mutex
+	partitions map[topicPartition]struct{}
+}
+
+func newLagGauges(m ports.Metrics) *lagGauges {
+	return &lagGauges{metrics: m, partitions: make(map[topicPartition]struct{})}
+}
+
+func (g *lagGauges) report(topic string, partition int, lag int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.partitions[topicPartition{topic: topic, partition: partition}] = struct{}{}
+	g.metrics.ConsumerLag(topic, partition, lag)
+}
+
+// revoke drops the lag of every partition reported so far.
+func (g *lagGauges) revoke() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for tp := range g.partitions {
+		g.metrics.ConsumerLagRevoked(tp.topic, tp.partition)
+	}
+	clear(g.partitions)
+}
@@ -0,0 +1,99 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+func TestOffsetTracker_CommitsOnlyContiguousOffsets(t *testing.T) {
+	tr := newOffsetTracker()
+	for _, off := range []int64{10, 11, 12, 14} {
+		tr.track("messages", 0, off)
+	}
+
+	if _, ok := tr.complete("messages", 0, 12); ok {
+		t.Fatal("expected no commit while offsets 10 and 11 are in flight")
+	}
+	if _, ok := tr.complete("messages", 0, 11); ok {
+		t.Fatal("expected no commit while offset 10 is in flight")
+	}
+
+	commit, ok := tr.complete("messages", 0, 10)
+	if !ok || commit != 12 {
+		t.Fatalf("complete(10) = (%d, %v), expected (12, true)", commit, ok)
+	}
+
+	// Offset 13 was never fetched (e.g. compacted away); 14 follows 12 directly.
+	commit, ok = tr.complete("messages", 0, 14)
+	if !ok || commit != 14 {
+		t.Fatalf("complete(14) = (%d, %v), expected (14, true)", commit, ok)
+	}
+}
+
+func TestOffsetTracker_PartitionsAreIndependent(t *testing.T) {
+	tr := newOffsetTracker()
+	tr.track("messages", 0, 5)
+	tr.track("messages", 1, 5)
+	tr.track("messages", 1, 6)
+
+	commit, ok := tr.complete("messages", 1, 5)
+	if !ok || commit != 5 {
+		t.Fatalf("complete(p1, 5) = (%d, %v), expected (5, true)", commit, ok)
+	}
+	if _, ok := tr.complete("other", 0, 5); ok {
+		t.Fatal("expected no commit for an untracked partition")
+	}
+}
+
+func TestOffsetTracker_RewindResetsPartition(t *testing.T) {
+	tr := newOffsetTracker()
+	tr.track("messages", 0, 20)
+	tr.track("messages", 0, 21)
+
+	// A rebalance redelivers from 20; the stale in-flight state is dropped.
+	tr.track("messages", 0, 20)
+
+	commit, ok := tr.complete("messages", 0, 20)
+	if !ok || commit != 20 {
+		t.Fatalf("complete(20) = (%d, %v), expected (20, true)", commit, ok)
+	}
+}
+
+// lagMetrics records the lag gauges currently set.
+type lagMetrics struct {
+	ports.NopMetrics
+	lag map[topicPartition]int64
+}
+
+func (m *lagMetrics) ConsumerLag(topic string, partition int, lag int64) {
+	m.lag[topicPartition{topic: topic, partition: partition}] = lag
+}
+
+func (m *lagMetrics) ConsumerLagRevoked(topic string, partition int) {
+	delete(m.lag, topicPartition{topic: topic, partition: partition})
+}
+
+func TestLagGauges_RevokeDropsReportedPartitions(t *testing.T) {
+	m := &lagMetrics{lag: make(map[topicPartition]int64)}
+	g := newLagGauges(m)
+
+	g.report("messages", 0, 5)
+	g.report("messages", 1, 7)
+	g.report("messages", 0, 4)
+	if len(m.lag) != 2 || m.lag[topicPartition{"messages", 0}] != 4 {
+		t.Fatalf("expected the latest lag of 2 partitions, got %v", m.lag)
+	}
+
+	g.revoke()
+	if len(m.lag) != 0 {
+		t.Fatalf("expected revoked partitions to drop their lag, got %v", m.lag)
+	}
+
+	// Partitions assigned again in the next generation are reported afresh.
+	g.report("messages", 1, 3)
+	g.revoke()
+	if len(m.lag) != 0 {
+		t.Fatalf("expected no lag after the second revoke, got %v", m.lag)
+	}
+}
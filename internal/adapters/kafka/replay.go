@@ -0,0 +1,212 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// StartOffset selects where a consumer group without committed offsets
+// starts reading a partition.
+type StartOffset string
+
+// Supported start offsets.
+const (
+	StartEarliest StartOffset = "earliest"
+	StartLatest   StartOffset = "latest"
+)
+
+// ParseStartOffset validates s as a start offset.
+func ParseStartOffset(s string) (StartOffset, error) {
+	switch o := StartOffset(s); o {
+	case StartEarliest, StartLatest:
+		return o, nil
+	default:
+		return "", fmt.Errorf("invalid start offset %q: must be one of earliest, latest", s)
+	}
+}
+
+// WithStartOffset sets where the group starts reading partitions it has no
+// committed offset for, or whose committed offset is out of range. The
+// default is StartEarliest.
+func WithStartOffset(o StartOffset) Option {
+	return func(c *Consumer) {
+		c.startOffset = o
+	}
+}
+
+// ErrGroupActive is returned by Replay while the consumer group has members.
+var ErrGroupActive = errors.New("consumer group has active members")
+
+// Replay describes the offsets to rewind the consumer group to.
+type Replay struct {
+	// From, if set, moves every partition of the subscribed topics to the
+	// first record with a timestamp at or after it, or to the end of the
+	// partition if there is none.
+	From time.Time
+
+	// Offsets moves individual partitions, keyed by topic and partition, to
+	// explicit offsets. It takes precedence over From.
+	Offsets map[string]map[int]int64
+}
+
+func (r Replay) validate() error {
+	if r.From.IsZero() && len(r.Offsets) == 0 {
+		return errors.New("replay needs a timestamp or offsets")
+	}
+	for topic, offsets := range r.Offsets {
+		for partition, offset := range offsets {
+			if partition < 0 || offset < 0 {
+				return fmt.Errorf("invalid replay offset %d for %s/%d", offset, topic, partition)
+			}
+		}
+	}
+	return nil
+}
+
+// Replay commits the offsets described by r for the consumer group, so that
+// its consumers resume from them. It is meant to be run once, as a separate
+// job, while the group is stopped: the coordinator only accepts offsets
+// committed from outside an empty group, so ErrGroupActive is returned
+// without changing anything while any consumer of the group is running.
+func (c *Consumer) Replay(ctx context.Context, r Replay) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+
+	topics := c.subscription.Topics
+	if c.subscription.Pattern != nil {
+		var err error
+		if topics, err = c.resolveTopics(ctx); err != nil {
+			return err
+		}
+		if len(topics) == 0 {
+			return fmt.Errorf("no topics match %s", c.subscription)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	client := &kafkago.Client{Addr: kafkago.TCP(c.brokers...), Transport: c.transport}
+	if err := c.checkGroupEmpty(ctx, client); err != nil {
+		return err
+	}
+	return c.resetOffsets(ctx, client, topics, r)
+}
+
+// checkGroupEmpty returns ErrGroupActive if the consumer group has members.
+func (c *Consumer) checkGroupEmpty(ctx context.Context, client *kafkago.Client) error {
+	group := c.readerConfig.GroupID
+	res, err := client.DescribeGroups(ctx, &kafkago.DescribeGroupsRequest{
+		Addr:     client.Addr,
+		GroupIDs: []string{group},
+	})
+	if err != nil {
+		return fmt.Errorf("describe consumer group %q: %w", group, err)
+	}
+	for _, g := range res.Groups {
+		if g.Error != nil {
+			return fmt.Errorf("describe consumer group %q: %w", group, g.Error)
+		}
+		if len(g.Members) > 0 {
+			return fmt.Errorf("%w: %q is %s with %d members; stop them before replaying",
+				ErrGroupActive, group, g.GroupState, len(g.Members))
+		}
+	}
+	return nil
+}
+
+// resetOffsets commits the offsets of r for the partitions of topics.
+func (c *Consumer) resetOffsets(ctx context.Context, client *kafkago.Client, topics []string, r Replay) error {
+	partitions, err := c.readPartitions(ctx, topics...)
+	if err != nil {
+		return err
+	}
+
+	offsets := make(map[topicPartition]int64)
+	if !r.From.IsZero() {
+		for _, p := range partitions {
+			offset, err := c.offsetAt(ctx, p, r.From)
+			if err != nil {
+				return fmt.Errorf("find offset of %s/%d at %s: %w", p.Topic, p.ID, r.From.Format(time.RFC3339), err)
+			}
+			offsets[topicPartition{topic: p.Topic, partition: p.ID}] = offset
+		}
+	}
+	for topic, byPartition := range r.Offsets {
+		for partition, offset := range byPartition {
+			exists := slices.ContainsFunc(partitions, func(p kafkago.Partition) bool {
+				return p.Topic == topic && p.ID == partition
+			})
+			if !exists {
+				return fmt.Errorf("partition %s/%d is not subscribed", topic, partition)
+			}
+			offsets[topicPartition{topic: topic, partition: partition}] = offset
+		}
+	}
+
+	commits := make(map[string][]kafkago.OffsetCommit)
+	for tp, offset := range offsets {
+		commits[tp.topic] = append(commits[tp.topic], kafkago.OffsetCommit{Partition: tp.partition, Offset: offset})
+	}
+
+	// A generation of -1 commits on behalf of the group rather than as one
+	// of its members, which the coordinator only accepts for an empty group.
+	res, err := client.OffsetCommit(ctx, &kafkago.OffsetCommitRequest{
+		Addr:         client.Addr,
+		GroupID:      c.readerConfig.GroupID,
+		GenerationID: -1,
+		Topics:       commits,
+	})
+	if err != nil {
+		return fmt.Errorf("commit replay offsets: %w", err)
+	}
+	var errs []error
+	for topic, results := range res.Topics {
+		for _, r := range results {
+			if r.Error != nil {
+				errs = append(errs, fmt.Errorf("commit replay offset of %s/%d: %w", topic, r.Partition, r.Error))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for tp, offset := range offsets {
+		c.logger.InfoContext(ctx, "consumer group offset reset for replay",
+			"group", c.readerConfig.GroupID, "topic", tp.topic, "partition", tp.partition, "offset", offset)
+	}
+	return nil
+}
+
+// offsetAt returns the offset of the first record of p with a timestamp at
+// or after t, or the end offset of p if there is none.
+func (c *Consumer) offsetAt(ctx context.Context, p kafkago.Partition, t time.Time) (int64, error) {
+	conn, err := c.readerConfig.Dialer.DialPartition(ctx, "tcp", "", p)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return 0, err
+		}
+	}
+
+	offset, err := conn.ReadOffset(t)
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return conn.ReadLastOffset()
+	}
+	return offset, nil
+}
@@ -0,0 +1,56 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestNewConsumerStartOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		want    int64
+		wantErr bool
+	}{
+		{name: "default", want: kafkago.FirstOffset},
+		{name: "earliest", opts: []Option{WithStartOffset(StartEarliest)}, want: kafkago.FirstOffset},
+		{name: "latest", opts: []Option{WithStartOffset(StartLatest)}, want: kafkago.LastOffset},
+		{name: "unknown", opts: []Option{WithStartOffset("newest")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewConsumer([]string{"localhost:9092"}, Topics("messages"), "indexer-group", tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConsumer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if c.readerConfig.StartOffset != tt.want {
+				t.Fatalf("expected start offset %d, got %d", tt.want, c.readerConfig.StartOffset)
+			}
+		})
+	}
+}
+
+func TestReplayRejectsInvalidReplay(t *testing.T) {
+	c, err := NewConsumer([]string{"localhost:9092"}, Topics("messages"), "indexer-group")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Invalid replays are rejected before any broker is contacted.
+	replays := []Replay{
+		{},
+		{Offsets: map[string]map[int]int64{"messages": {0: -1}}},
+		{Offsets: map[string]map[int]int64{"messages": {-1: 10}}},
+	}
+	for _, r := range replays {
+		if err := c.Replay(context.Background(), r); err == nil {
+			t.Fatalf("expected error for replay %+v", r)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Supported SASL mechanisms.
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// dialTimeout bounds establishing a broker connection, including the TLS and
+// SASL handshakes.
+const dialTimeout = 10 * time.Second
+
+// SecurityConfig describes how to secure broker connections. The zero value
+// connects in plaintext without authentication.
+type SecurityConfig struct {
+	// TLSEnabled turns on TLS. The file paths are optional: without a CA the
+	// system roots are used, and a client certificate is only presented when
+	// both TLSCertFile and TLSKeyFile are set.
+	TLSEnabled            bool
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify bool
+
+	// SASLMechanism is one of SASLPlain, SASLScramSHA256 or SASLScramSHA512,
+	// or empty to disable SASL.
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+}
+
+// Security holds the TLS configuration and SASL mechanism shared by every
+// connection the adapters open to the brokers.
+type Security struct {
+	tls  *tls.Config
+	sasl sasl.Mechanism
+}
+
+// NewSecurity loads the certificates and builds the SASL mechanism described
+// by cfg.
+func NewSecurity(cfg SecurityConfig) (Security, error) {
+	var s Security
+
+	if cfg.TLSEnabled {
+		tlsCfg, err := newTLSConfig(cfg)
+		if err != nil {
+			return Security{}, err
+		}
+		s.tls = tlsCfg
+	}
+
+	if cfg.SASLMechanism != "" {
+		mechanism, err := newSASLMechanism(cfg.SASLMechanism, cfg.SASLUsername, cfg.SASLPassword)
+		if err != nil {
+			return Security{}, err
+		}
+		s.sasl = mechanism
+	}
+
+	return s, nil
+}
+
+func newTLSConfig(cfg SecurityConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read kafka ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka ca file %s contains no PEM certificates", cfg.TLSCAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("kafka client certificate and key must be set together")
+	}
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load kafka client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+func newSASLMechanism(mechanism, username, password string) (sasl.Mechanism, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("sasl %s requires a username and password", mechanism)
+	}
+
+	switch strings.ToUpper(mechanism) {
+	case SASLPlain:
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, username, password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, username, password)
+	default:
+		return nil, fmt.Errorf("unsupported sasl mechanism %q", mechanism)
+	}
+}
+
+// dialer returns a Dialer for the reader and health checks.
+func (s Security) dialer() *kafkago.Dialer {
+	return &kafkago.Dialer{
+		Timeout:       dialTimeout,
+		DualStack:     true,
+		TLS:           s.tls,
+		SASLMechanism: s.sasl,
+	}
+}
+
+// transport returns a Transport for writers.
+func (s Security) transport() *kafkago.Transport {
+	return &kafkago.Transport{
+		DialTimeout: dialTimeout,
+		TLS:         s.tls,
+		SASL:        s.sasl,
+	}
+}
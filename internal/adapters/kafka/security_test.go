@@ -0,0 +1,132 @@
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key to dir
+// and returns their paths.
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewSecurityTLS(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, t.TempDir())
+
+	sec, err := NewSecurity(SecurityConfig{
+		TLSEnabled:  true,
+		TLSCAFile:   certFile,
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	d := sec.dialer()
+	if d.TLS == nil || d.TLS.RootCAs == nil {
+		t.Fatal("expected dialer TLS config with a custom CA pool")
+	}
+	if len(d.TLS.Certificates) != 1 {
+		t.Fatalf("expected 1 client certificate, got %d", len(d.TLS.Certificates))
+	}
+	if sec.transport().TLS != d.TLS {
+		t.Fatal("expected transport to share the dialer TLS config")
+	}
+}
+
+func TestNewSecuritySASL(t *testing.T) {
+	for _, mechanism := range []string{SASLPlain, SASLScramSHA256, SASLScramSHA512} {
+		t.Run(mechanism, func(t *testing.T) {
+			sec, err := NewSecurity(SecurityConfig{SASLMechanism: mechanism, SASLUsername: "indexer", SASLPassword: "s3cret"})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := sec.dialer().SASLMechanism.Name(); got != mechanism {
+				t.Fatalf("expected mechanism %s, got %s", mechanism, got)
+			}
+			if sec.dialer().TLS != nil {
+				t.Fatal("expected plaintext connections when TLS is disabled")
+			}
+		})
+	}
+
+	sec, err := NewSecurity(SecurityConfig{SASLMechanism: SASLPlain, SASLUsername: "indexer", SASLPassword: "s3cret"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := sec.transport().SASL.(plain.Mechanism).Username; got != "indexer" {
+		t.Fatalf("expected transport username indexer, got %s", got)
+	}
+}
+
+func TestNewSecurityRejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _ := writeTestCertificate(t, dir)
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  SecurityConfig
+	}{
+		{name: "missing ca file", cfg: SecurityConfig{TLSEnabled: true, TLSCAFile: filepath.Join(dir, "missing.pem")}},
+		{name: "ca file without certificates", cfg: SecurityConfig{TLSEnabled: true, TLSCAFile: notPEM}},
+		{name: "cert without key", cfg: SecurityConfig{TLSEnabled: true, TLSCertFile: certFile}},
+		{name: "unknown sasl mechanism", cfg: SecurityConfig{SASLMechanism: "GSSAPI", SASLUsername: "u", SASLPassword: "p"}},
+		{name: "sasl without password", cfg: SecurityConfig{SASLMechanism: SASLPlain, SASLUsername: "u"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSecurity(tt.cfg); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// StatusPrecedence decides between the status header and the status_code
+// field of the payload when both are present.
+type StatusPrecedence string
+
+// Supported precedence rules. A zero status_code counts as absent, as the
+// domain already treats it as the default.
+const (
+	// StatusPayloadFirst keeps a non-zero payload status_code and only falls
+	// back to the header when the payload has none.
+	StatusPayloadFirst StatusPrecedence = "payload"
+	// StatusHeaderFirst lets the header override the payload status_code.
+	StatusHeaderFirst StatusPrecedence = "header"
+)
+
+// ParseStatusPrecedence validates s as a status precedence rule.
+func ParseStatusPrecedence(s string) (StatusPrecedence, error) {
+	switch p := StatusPrecedence(s); p {
+	case StatusPayloadFirst, StatusHeaderFirst:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid status precedence %q: must be one of payload, header", s)
+	}
+}
+
+// WithStatusHeader reads the event status from the record header named name,
+// matched case-insensitively, for producers that cannot change the payload.
+// precedence decides which wins when the payload carries a status too. A
+// header that is not an integer makes the record undecodable.
+func WithStatusHeader(name string, precedence StatusPrecedence) Option {
+	return func(c *Consumer) {
+		c.statusHeader = name
+		c.statusPrecedence = precedence
+	}
+}
+
+// eventStatus returns the status of a record whose payload carries
+// payloadStatus, applying the status header if one is configured.
+func (c *Consumer) eventStatus(payloadStatus int, headers []kafkago.Header) (int, error) {
+	if c.statusHeader == "" {
+		return payloadStatus, nil
+	}
+	if payloadStatus != 0 && c.statusPrecedence == StatusPayloadFirst {
+		return payloadStatus, nil
+	}
+
+	// The last occurrence wins, as with any repeated header.
+	var raw []byte
+	found := false
+	for _, h := range headers {
+		if strings.EqualFold(h.Key, c.statusHeader) {
+			raw, found = h.Value, true
+		}
+	}
+	if !found {
+		return payloadStatus, nil
+	}
+
+	status, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return 0, fmt.Errorf("status header %q: %q is not an integer", c.statusHeader, raw)
+	}
+	return status, nil
+}
@@ -0,0 +1,58 @@
+package kafka
+
+import (
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestConsumerEventStatus(t *testing.T) {
+	header := func(key, value string) []kafkago.Header {
+		return []kafkago.Header{{Key: key, Value: []byte(value)}}
+	}
+
+	tests := []struct {
+		name          string
+		headerName    string
+		precedence    StatusPrecedence
+		payloadStatus int
+		headers       []kafkago.Header
+		want          int
+		wantErr       bool
+	}{
+		{name: "disabled", payloadStatus: 200, headers: header("x-status-code", "500"), want: 200},
+		{name: "fills absent status", headerName: "x-status-code", precedence: StatusPayloadFirst, headers: header("x-status-code", "404"), want: 404},
+		{name: "payload wins", headerName: "x-status-code", precedence: StatusPayloadFirst, payloadStatus: 200, headers: header("x-status-code", "500"), want: 200},
+		{name: "header wins", headerName: "x-status-code", precedence: StatusHeaderFirst, payloadStatus: 200, headers: header("x-status-code", "500"), want: 500},
+		{name: "case-insensitive name", headerName: "x-status-code", precedence: StatusHeaderFirst, headers: header("X-Status-Code", " 503 "), want: 503},
+		{name: "missing header keeps payload", headerName: "x-status-code", precedence: StatusHeaderFirst, payloadStatus: 201, want: 201},
+		{
+			name:       "last occurrence wins",
+			headerName: "x-status-code",
+			precedence: StatusHeaderFirst,
+			headers:    append(header("x-status-code", "500"), header("x-status-code", "200")...),
+			want:       200,
+		},
+		{name: "invalid header", headerName: "x-status-code", precedence: StatusHeaderFirst, headers: header("x-status-code", "oops"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Consumer{statusHeader: tt.headerName, statusPrecedence: tt.precedence}
+			got, err := c.eventStatus(tt.payloadStatus, tt.headers)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("eventStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("eventStatus() = %d, expected %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConsumerRejectsInvalidStatusPrecedence(t *testing.T) {
+	_, err := NewConsumer([]string{"localhost:9092"}, Topics("messages"), "indexer-group", WithStatusHeader("x-status-code", "both"))
+	if err == nil {
+		t.Fatal("expected error for invalid status precedence")
+	}
+}
@@ -0,0 +1,155 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// defaultTopicRefresh is how often a pattern subscription is re-resolved
+// when no interval is given.
+const defaultTopicRefresh = time.Minute
+
+// errSubscriptionChanged ends a stream whose pattern now matches a different
+// set of topics. It is transient: the next Stream joins the group with the
+// new topics.
+var errSubscriptionChanged = errors.New("kafka topic subscription changed")
+
+// Subscription selects the topics a Consumer reads: either a fixed list, or
+// every topic whose name matches a pattern.
+type Subscription struct {
+	// Topics is the fixed list of topics, used when Pattern is nil.
+	Topics []string
+
+	// Pattern, if set, subscribes to every topic it matches. Internal topics,
+	// whose names start with "__", are never matched.
+	Pattern *regexp.Regexp
+
+	// RefreshInterval is how often Pattern is re-resolved against the cluster
+	// metadata, so that new or deleted topics are picked up. It defaults to
+	// one minute.
+	RefreshInterval time.Duration
+}
+
+// Topics subscribes to a fixed list of topics.
+func Topics(names ...string) Subscription {
+	return Subscription{Topics: names}
+}
+
+// TopicPattern subscribes to every topic matching pattern, re-resolved every
+// refresh.
+func TopicPattern(pattern *regexp.Regexp, refresh time.Duration) Subscription {
+	return Subscription{Pattern: pattern, RefreshInterval: refresh}
+}
+
+// String describes the subscription for logs.
+func (s Subscription) String() string {
+	if s.Pattern != nil {
+		return "/" + s.Pattern.String() + "/"
+	}
+	return strings.Join(s.Topics, ",")
+}
+
+func (s Subscription) validate() error {
+	if s.Pattern != nil {
+		return nil
+	}
+	if len(s.Topics) == 0 {
+		return fmt.Errorf("topics must not be empty")
+	}
+	for _, topic := range s.Topics {
+		if topic == "" {
+			return fmt.Errorf("topic names must not be empty")
+		}
+	}
+	return nil
+}
+
+// match returns the sorted, distinct topics of partitions that the pattern
+// matches.
+func (s Subscription) match(partitions []kafkago.Partition) []string {
+	var topics []string
+	for _, p := range partitions {
+		if strings.HasPrefix(p.Topic, "__") || !s.Pattern.MatchString(p.Topic) {
+			continue
+		}
+		topics = append(topics, p.Topic)
+	}
+	slices.Sort(topics)
+	return slices.Compact(topics)
+}
+
+// subscribe returns a new reader to fetch from, and the topics it reads.
+// Every Stream thus fetches from the committed offsets, redelivering messages
+// a previous stream fetched but never committed. For a pattern subscription
+// the matching topics are resolved first.
+func (c *Consumer) subscribe(ctx context.Context) (*kafkago.Reader, []string, error) {
+	topics := c.subscription.Topics
+	if c.subscription.Pattern != nil {
+		var err error
+		if topics, err = c.resolveTopics(ctx); err != nil {
+			return nil, nil, err
+		}
+		if len(topics) == 0 {
+			return nil, nil, fmt.Errorf("no topics match %s", c.subscription)
+		}
+	}
+
+	cfg := c.readerConfig
+	cfg.GroupTopics = topics
+	reader := kafkago.NewReader(cfg)
+	c.logger.InfoContext(ctx, "subscribed to kafka topics", "subscription", c.subscription.String(), "topics", topics)
+	return reader, topics, nil
+}
+
+// resolveTopics lists the topics that currently match the pattern.
+func (c *Consumer) resolveTopics(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	partitions, err := c.readPartitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list topics: %w", err)
+	}
+	return c.subscription.match(partitions), nil
+}
+
+// watchTopics re-resolves the pattern every refresh interval and calls
+// changed once the matching topics differ from current. It returns when ctx
+// is done or after calling changed.
+func (c *Consumer) watchTopics(ctx context.Context, current []string, changed func()) {
+	interval := c.subscription.RefreshInterval
+	if interval <= 0 {
+		interval = defaultTopicRefresh
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		topics, err := c.resolveTopics(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.WarnContext(ctx, "failed to refresh kafka topics", "error", err)
+			}
+			continue
+		}
+		if !slices.Equal(topics, current) {
+			c.logger.InfoContext(ctx, "kafka topics matching pattern changed",
+				"pattern", c.subscription.Pattern.String(), "previous", current, "topics", topics)
+			changed()
+			return
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestSubscriptionMatch(t *testing.T) {
+	sub := TopicPattern(regexp.MustCompile(`^(events\..+|__.*)$`), time.Minute)
+	partitions := []kafkago.Partition{
+		{Topic: "events.orders", ID: 0},
+		{Topic: "events.orders", ID: 1},
+		{Topic: "events.billing", ID: 0},
+		{Topic: "messages", ID: 0},
+		{Topic: "__consumer_offsets", ID: 0},
+	}
+
+	got := sub.match(partitions)
+	want := []string{"events.billing", "events.orders"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("match() = %v, expected %v", got, want)
+	}
+}
+
+func TestNewConsumerSubscription(t *testing.T) {
+	brokers := []string{"localhost:9092"}
+
+	tests := []struct {
+		name    string
+		sub     Subscription
+		wantErr bool
+	}{
+		{name: "single topic", sub: Topics("messages")},
+		{name: "several topics", sub: Topics("orders", "payments")},
+		{name: "pattern", sub: TopicPattern(regexp.MustCompile(`^events\.`), time.Minute)},
+		{name: "no topics", sub: Topics(), wantErr: true},
+		{name: "empty topic name", sub: Topics("orders", ""), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewConsumer(brokers, tt.sub, "indexer-group")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConsumer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				_ = c.Close()
+			}
+		})
+	}
+}
+
+func TestSubscribeCreatesReaderPerStream(t *testing.T) {
+	c, err := NewConsumer([]string{"localhost:9092"}, Topics("messages"), "indexer-group")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	first, _, err := c.subscribe(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer func() { _ = first.Close() }()
+	second, topics, err := c.subscribe(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer func() { _ = second.Close() }()
+
+	// A fresh reader refetches from the committed offsets, so messages the
+	// previous stream left unacknowledged are delivered again.
+	if first == second {
+		t.Fatal("expected a new reader for every subscribe")
+	}
+	if len(topics) != 1 || topics[0] != "messages" {
+		t.Fatalf("expected topics [messages], got %v", topics)
+	}
+}
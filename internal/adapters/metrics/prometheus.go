@@ -0,0 +1,138 @@
+// Package metrics implements ports.Metrics on top of Prometheus.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+)
+
+const namespace = "kflow"
+
+// Prometheus implements ports.Metrics with Prometheus collectors.
+type Prometheus struct {
+	consumed     *prometheus.CounterVec
+	indexed      *prometheus.CounterVec
+	skipped      *prometheus.CounterVec
+	deadLettered *prometheus.CounterVec
+	retried      *prometheus.CounterVec
+	bulkDuration prometheus.Histogram
+	bulkSize     prometheus.Histogram
+	inFlight     prometheus.Gauge
+	consumerLag  *prometheus.GaugeVec
+}
+
+// NewPrometheus creates the pipeline collectors and registers them with reg.
+func NewPrometheus(reg prometheus.Registerer) (*Prometheus, error) {
+	m := &Prometheus{
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_consumed_total",
+			Help:      "Records read from Kafka, by status category.",
+		}, []string{"category"}),
+		indexed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_indexed_total",
+			Help:      "Events persisted in Elasticsearch, by status category.",
+		}, []string{"category"}),
+		skipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_skipped_total",
+			Help:      "Events acknowledged without indexing, by status category.",
+		}, []string{"category"}),
+		deadLettered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_dead_lettered_total",
+			Help:      "Messages parked on the dead letter queue, or dropped without one, by status category and reason.",
+		}, []string{"category", "reason"}),
+		retried: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_retried_total",
+			Help:      "Retries of messages after transient failures, by status category.",
+		}, []string{"category"}),
+		bulkDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "bulk_duration_seconds",
+			Help:      "Latency of Elasticsearch bulk requests.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		bulkSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "bulk_batch_size",
+			Help:      "Number of events per Elasticsearch bulk request.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+		}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "messages_in_flight",
+			Help:      "Messages received by workers and not yet settled.",
+		}),
+		consumerLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "consumer_lag",
+			Help:      "Records between the last fetched offset and the partition high watermark.",
+		}, []string{"topic", "partition"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.consumed, m.indexed, m.skipped, m.deadLettered, m.retried,
+		m.bulkDuration, m.bulkSize, m.inFlight, m.consumerLag,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// MessageConsumed counts a record read from Kafka.
+func (m *Prometheus) MessageConsumed(category domain.StatusCategory) {
+	m.consumed.WithLabelValues(category.String()).Inc()
+}
+
+// MessageIndexed counts an event persisted in Elasticsearch.
+func (m *Prometheus) MessageIndexed(category domain.StatusCategory) {
+	m.indexed.WithLabelValues(category.String()).Inc()
+}
+
+// MessageSkipped counts an event acknowledged without indexing.
+func (m *Prometheus) MessageSkipped(category domain.StatusCategory) {
+	m.skipped.WithLabelValues(category.String()).Inc()
+}
+
+// MessageDeadLettered counts a message parked on the DLQ, or dropped when
+// none is configured, for reason.
+func (m *Prometheus) MessageDeadLettered(category domain.StatusCategory, reason string) {
+	m.deadLettered.WithLabelValues(category.String(), reason).Inc()
+}
+
+// MessageRetried counts a retry after a transient failure.
+func (m *Prometheus) MessageRetried(category domain.StatusCategory) {
+	m.retried.WithLabelValues(category.String()).Inc()
+}
+
+// BulkCompleted observes the latency and size of a bulk request.
+func (m *Prometheus) BulkCompleted(duration time.Duration, size int) {
+	m.bulkDuration.Observe(duration.Seconds())
+	m.bulkSize.Observe(float64(size))
+}
+
+// InFlightAdd adjusts the number of messages being processed.
+func (m *Prometheus) InFlightAdd(delta int) {
+	m.inFlight.Add(float64(delta))
+}
+
+// ConsumerLag sets the lag gauge of a partition.
+func (m *Prometheus) ConsumerLag(topic string, partition int, lag int64) {
+	m.consumerLag.WithLabelValues(topic, strconv.Itoa(partition)).Set(float64(lag))
+}
+
+// ConsumerLagRevoked deletes the lag gauge of a revoked partition, so that
+// another instance reports it without this one's stale value lingering.
+func (m *Prometheus) ConsumerLagRevoked(topic string, partition int) {
+	m.consumerLag.DeleteLabelValues(topic, strconv.Itoa(partition))
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+)
+
+func TestPrometheusRecordsPipelineMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewPrometheus(reg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	m.MessageConsumed(domain.StatusCategorySuccess)
+	m.MessageConsumed(domain.StatusCategoryClientError)
+	m.MessageIndexed(domain.StatusCategorySuccess)
+	m.MessageDeadLettered(domain.StatusCategoryClientError, "invalid_data")
+	m.MessageRetried(domain.StatusCategoryServerError)
+	m.BulkCompleted(20*time.Millisecond, 8)
+	m.InFlightAdd(3)
+	m.InFlightAdd(-1)
+	m.ConsumerLag("messages", 2, 42)
+
+	if got := testutil.ToFloat64(m.consumed.WithLabelValues("success")); got != 1 {
+		t.Fatalf("expected 1 consumed success, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.deadLettered.WithLabelValues("client_error", "invalid_data")); got != 1 {
+		t.Fatalf("expected 1 dead-lettered client error, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.retried.WithLabelValues("server_error")); got != 1 {
+		t.Fatalf("expected 1 retried server error, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.inFlight); got != 2 {
+		t.Fatalf("expected 2 in flight, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.consumerLag.WithLabelValues("messages", "2")); got != 42 {
+		t.Fatalf("expected lag 42, got %v", got)
+	}
+	m.ConsumerLagRevoked("messages", 2)
+	if got := testutil.CollectAndCount(m.consumerLag); got != 0 {
+		t.Fatalf("expected revoked lag series to be deleted, got %d", got)
+	}
+	if got := testutil.CollectAndCount(m.bulkSize); got != 1 {
+		t.Fatalf("expected 1 bulk size series, got %d", got)
+	}
+}
+
+func TestNewPrometheusRejectsDuplicateRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := NewPrometheus(reg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := NewPrometheus(reg); err == nil {
+		t.Fatal("expected error when registering collectors twice")
+	}
+}
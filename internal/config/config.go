@@ -2,6 +2,15 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 )
@@ -9,12 +18,118 @@ import (
 // Config holds the runtime configuration for the indexer service.
 type Config struct {
 	KafkaBrokers   []string `env:"KAFKA_BROKERS,notEmpty" envSeparator:","`
-	KafkaTopic     string   `env:"KAFKA_TOPIC" envDefault:"messages"`
+	KafkaTopics    []string `env:"KAFKA_TOPIC" envDefault:"messages" envSeparator:","`
 	KafkaGroupID   string   `env:"KAFKA_GROUP_ID" envDefault:"indexer-group"`
-	ElasticURLs    []string `env:"ELASTIC_URLS,notEmpty" envSeparator:","`
+	KafkaDLQTopic  string   `env:"KAFKA_DLQ_TOPIC" envDefault:"messages-dlq"`
+	ElasticURLs    []string `env:"ELASTIC_URLS" envSeparator:","`
 	ElasticIndex   string   `env:"ELASTIC_INDEX" envDefault:"messages"`
+	ElasticRefresh string   `env:"ELASTIC_REFRESH" envDefault:"false"`
 	WorkerCount    int      `env:"WORKER_COUNT" envDefault:"5"`
+	DispatchMode   string   `env:"DISPATCH_MODE" envDefault:"shared"`
 	LogLevel       string   `env:"LOG_LEVEL" envDefault:"INFO"`
+
+	// AdminAddr is the listen address of the unauthenticated admin endpoints.
+	// It defaults to loopback only, so they are reachable through kubectl
+	// port-forward but not from the pod network.
+	AdminAddr string `env:"ADMIN_ADDR" envDefault:"localhost:8081"`
+
+	// KafkaTopicPattern, if set, subscribes to every topic matching the
+	// regular expression instead of KafkaTopics, re-resolved every
+	// KafkaTopicRefreshInterval.
+	KafkaTopicPattern         string        `env:"KAFKA_TOPIC_PATTERN"`
+	KafkaTopicRefreshInterval time.Duration `env:"KAFKA_TOPIC_REFRESH_INTERVAL" envDefault:"1m"`
+
+	// KafkaStartOffset is where the group starts reading partitions without
+	// a committed offset: earliest or latest.
+	KafkaStartOffset string `env:"KAFKA_START_OFFSET" envDefault:"earliest"`
+
+	// Kafka fetch and consumer group tuning. The defaults match kafka-go's;
+	// KafkaIsolationLevel read_committed skips records of aborted
+	// transactions.
+	KafkaMinBytes          int           `env:"KAFKA_MIN_BYTES" envDefault:"1"`
+	KafkaMaxBytes          int           `env:"KAFKA_MAX_BYTES" envDefault:"1000000"`
+	KafkaMaxWait           time.Duration `env:"KAFKA_MAX_WAIT" envDefault:"10s"`
+	KafkaSessionTimeout    time.Duration `env:"KAFKA_SESSION_TIMEOUT" envDefault:"30s"`
+	KafkaHeartbeatInterval time.Duration `env:"KAFKA_HEARTBEAT_INTERVAL" envDefault:"3s"`
+	KafkaRebalanceTimeout  time.Duration `env:"KAFKA_REBALANCE_TIMEOUT" envDefault:"30s"`
+	KafkaIsolationLevel    string        `env:"KAFKA_ISOLATION_LEVEL" envDefault:"read_uncommitted"`
+
+	// KafkaReplayFrom (RFC 3339) or KafkaReplayOffsets
+	// ("topic:partition=offset,...") are the target of the replay command.
+	// KafkaReplayPartitionOffsets holds the parsed offsets.
+	KafkaReplayFrom             time.Time                `env:"KAFKA_REPLAY_FROM"`
+	KafkaReplayOffsets          string                   `env:"KAFKA_REPLAY_OFFSETS"`
+	KafkaReplayPartitionOffsets map[string]map[int]int64 `env:"-"`
+
+	// KafkaMetadataPrefix, if set, merges each record's topic, partition,
+	// offset, key, timestamp and headers into the indexed event metadata
+	// under keys with this prefix.
+	KafkaMetadataPrefix string `env:"KAFKA_METADATA_PREFIX"`
+
+	// KafkaStatusHeader, if set, names a record header carrying the event
+	// status; KafkaStatusPrecedence decides whether it overrides the payload.
+	KafkaStatusHeader     string `env:"KAFKA_STATUS_HEADER"`
+	KafkaStatusPrecedence string `env:"KAFKA_STATUS_PRECEDENCE" envDefault:"payload"`
+
+	// Kafka TLS. The file paths are optional; without a CA the system roots
+	// are used.
+	KafkaTLSEnabled            bool   `env:"KAFKA_TLS_ENABLED" envDefault:"false"`
+	KafkaTLSCAFile             string `env:"KAFKA_TLS_CA_FILE"`
+	KafkaTLSCertFile           string `env:"KAFKA_TLS_CERT_FILE"`
+	KafkaTLSKeyFile            string `env:"KAFKA_TLS_KEY_FILE"`
+	KafkaTLSInsecureSkipVerify bool   `env:"KAFKA_TLS_INSECURE_SKIP_VERIFY" envDefault:"false"`
+
+	// Kafka SASL. Credentials may be read from files via the _FILE variants.
+	KafkaSASLMechanism    string `env:"KAFKA_SASL_MECHANISM"`
+	KafkaSASLUsername     string `env:"KAFKA_SASL_USERNAME"`
+	KafkaSASLUsernameFile string `env:"KAFKA_SASL_USERNAME_FILE"`
+	KafkaSASLPassword     string `env:"KAFKA_SASL_PASSWORD"`
+	KafkaSASLPasswordFile string `env:"KAFKA_SASL_PASSWORD_FILE"`
+
+	// Data stream mode: create actions with an @timestamp taken from the
+	// ELASTIC_TIMESTAMP_FIELD metadata entry, or the ingestion time.
+	// "kafka.timestamp" names the record timestamp.
+	ElasticDataStream     bool   `env:"ELASTIC_DATA_STREAM" envDefault:"false"`
+	ElasticTimestampField string `env:"ELASTIC_TIMESTAMP_FIELD" envDefault:"timestamp"`
+
+	// External versioning: index and delete actions carry a version read from
+	// ELASTIC_VERSION_SOURCE, so stale writes are ignored. Disabled when
+	// ELASTIC_VERSION_TYPE is empty.
+	ElasticVersionType   string `env:"ELASTIC_VERSION_TYPE"`
+	ElasticVersionSource string `env:"ELASTIC_VERSION_SOURCE" envDefault:"offset"`
+
+	// Template bootstrap: install component and index templates on startup
+	// and compare existing mappings against them. It is opt-in, as it needs
+	// the manage_index_templates privilege.
+	ElasticTemplateBootstrap bool   `env:"ELASTIC_TEMPLATE_BOOTSTRAP" envDefault:"false"`
+	ElasticTemplateName      string `env:"ELASTIC_TEMPLATE_NAME" envDefault:"kflow"`
+	ElasticPayloadMapping    string `env:"ELASTIC_PAYLOAD_MAPPING" envDefault:"flattened"`
+	ElasticMappingDrift      string `env:"ELASTIC_MAPPING_DRIFT" envDefault:"warn"`
+
+	// Elasticsearch connection and authentication. ELASTIC_URLS and
+	// ELASTIC_CLOUD_ID are mutually exclusive; secrets may be read from files
+	// via the _FILE variants.
+	ElasticCloudID                string `env:"ELASTIC_CLOUD_ID"`
+	ElasticUsername               string `env:"ELASTIC_USERNAME"`
+	ElasticUsernameFile           string `env:"ELASTIC_USERNAME_FILE"`
+	ElasticPassword               string `env:"ELASTIC_PASSWORD"`
+	ElasticPasswordFile           string `env:"ELASTIC_PASSWORD_FILE"`
+	ElasticAPIKey                 string `env:"ELASTIC_API_KEY"`
+	ElasticAPIKeyFile             string `env:"ELASTIC_API_KEY_FILE"`
+	ElasticCACertFile             string `env:"ELASTIC_CA_CERT_FILE"`
+	ElasticCertificateFingerprint string `env:"ELASTIC_CERT_FINGERPRINT"`
+
+	// Retry policy for 5xx events and transient indexer errors.
+	RetryMaxAttempts int           `env:"RETRY_MAX_ATTEMPTS" envDefault:"4"`
+	RetryBaseDelay   time.Duration `env:"RETRY_BASE_DELAY" envDefault:"200ms"`
+	RetryMultiplier  float64       `env:"RETRY_MULTIPLIER" envDefault:"2"`
+	RetryJitter      float64       `env:"RETRY_JITTER" envDefault:"0.2"`
+	RetryMaxDelay    time.Duration `env:"RETRY_MAX_DELAY" envDefault:"5s"`
+
+	// Micro-batching bounds for bulk indexing.
+	BatchMaxSize  int           `env:"BATCH_MAX_SIZE" envDefault:"500"`
+	BatchMaxBytes int           `env:"BATCH_MAX_BYTES" envDefault:"5242880"`
+	BatchLinger   time.Duration `env:"BATCH_LINGER" envDefault:"200ms"`
 }
 
 // Load parses environment variables into Config.
@@ -26,6 +141,309 @@ func Load() (*Config, error) {
 	if cfg.WorkerCount <= 0 {
 		cfg.WorkerCount = 1
 	}
+	switch cfg.DispatchMode {
+	case "shared", "partition", "key":
+	default:
+		return nil, fmt.Errorf("DISPATCH_MODE must be one of shared, partition, key; got %q", cfg.DispatchMode)
+	}
+	if err := cfg.validateLogLevel(); err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(cfg.AdminAddr); err != nil {
+		return nil, fmt.Errorf("ADMIN_ADDR must be a host:port address; got %q", cfg.AdminAddr)
+	}
+	if err := cfg.validateKafkaTopics(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateKafkaTuning(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateKafkaReplay(); err != nil {
+		return nil, err
+	}
+	switch cfg.KafkaStatusPrecedence {
+	case "payload", "header":
+	default:
+		return nil, fmt.Errorf("KAFKA_STATUS_PRECEDENCE must be one of payload, header; got %q", cfg.KafkaStatusPrecedence)
+	}
+	switch cfg.ElasticRefresh {
+	case "false", "true", "wait_for":
+	default:
+		return nil, fmt.Errorf("ELASTIC_REFRESH must be one of false, true, wait_for; got %q", cfg.ElasticRefresh)
+	}
+	if err := cfg.validateKafkaSecurity(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateElastic(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateRetry(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateBatch(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
+// LoadReplay parses environment variables into Config for the replay
+// command. Replay only rewinds the consumer group, so just the Kafka
+// connection, the subscription and the replay target are validated.
+func LoadReplay() (*Config, error) {
+	var cfg Config
+	if err := env.Parse(&cfg); err != nil {
+		return nil, fmt.Errorf("parse env config: %w", err)
+	}
+	if err := cfg.validateLogLevel(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateKafkaTopics(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateKafkaReplay(); err != nil {
+		return nil, err
+	}
+	if cfg.KafkaReplayFrom.IsZero() && cfg.KafkaReplayPartitionOffsets == nil {
+		return nil, fmt.Errorf("replay needs KAFKA_REPLAY_FROM or KAFKA_REPLAY_OFFSETS")
+	}
+	if err := cfg.validateKafkaSecurity(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validateLogLevel() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("LOG_LEVEL must be one of DEBUG, INFO, WARN, ERROR; got %q", c.LogLevel)
+	}
+	return nil
+}
+
+func (c *Config) validateKafkaTopics() error {
+	if c.KafkaTopicPattern != "" {
+		re, err := regexp.Compile(c.KafkaTopicPattern)
+		if err != nil {
+			return fmt.Errorf("KAFKA_TOPIC_PATTERN: %w", err)
+		}
+		if re.MatchString(c.KafkaDLQTopic) {
+			return fmt.Errorf("KAFKA_TOPIC_PATTERN %q must not match KAFKA_DLQ_TOPIC %q", c.KafkaTopicPattern, c.KafkaDLQTopic)
+		}
+		if c.KafkaTopicRefreshInterval <= 0 {
+			return fmt.Errorf("KAFKA_TOPIC_REFRESH_INTERVAL must be positive, got %v", c.KafkaTopicRefreshInterval)
+		}
+		return nil
+	}
+
+	for i, topic := range c.KafkaTopics {
+		c.KafkaTopics[i] = strings.TrimSpace(topic)
+	}
+	if len(c.KafkaTopics) == 0 || slices.Contains(c.KafkaTopics, "") {
+		return fmt.Errorf("KAFKA_TOPIC must be a comma-separated list of topic names")
+	}
+	if slices.Contains(c.KafkaTopics, c.KafkaDLQTopic) {
+		return fmt.Errorf("KAFKA_TOPIC must not include KAFKA_DLQ_TOPIC %q", c.KafkaDLQTopic)
+	}
+	return nil
+}
+
+func (c *Config) validateKafkaTuning() error {
+	if c.KafkaMinBytes < 1 {
+		return fmt.Errorf("KAFKA_MIN_BYTES must be at least 1, got %d", c.KafkaMinBytes)
+	}
+	if c.KafkaMaxBytes < c.KafkaMinBytes {
+		return fmt.Errorf("KAFKA_MAX_BYTES (%d) must be at least KAFKA_MIN_BYTES (%d)", c.KafkaMaxBytes, c.KafkaMinBytes)
+	}
+	if c.KafkaMaxWait <= 0 {
+		return fmt.Errorf("KAFKA_MAX_WAIT must be positive, got %v", c.KafkaMaxWait)
+	}
+	if c.KafkaSessionTimeout <= 0 {
+		return fmt.Errorf("KAFKA_SESSION_TIMEOUT must be positive, got %v", c.KafkaSessionTimeout)
+	}
+	if c.KafkaHeartbeatInterval <= 0 || c.KafkaHeartbeatInterval >= c.KafkaSessionTimeout {
+		return fmt.Errorf("KAFKA_HEARTBEAT_INTERVAL must be positive and shorter than KAFKA_SESSION_TIMEOUT (%v), got %v",
+			c.KafkaSessionTimeout, c.KafkaHeartbeatInterval)
+	}
+	if c.KafkaRebalanceTimeout <= 0 {
+		return fmt.Errorf("KAFKA_REBALANCE_TIMEOUT must be positive, got %v", c.KafkaRebalanceTimeout)
+	}
+	switch c.KafkaIsolationLevel {
+	case "read_uncommitted", "read_committed":
+	default:
+		return fmt.Errorf("KAFKA_ISOLATION_LEVEL must be one of read_uncommitted, read_committed; got %q", c.KafkaIsolationLevel)
+	}
+	return nil
+}
+
+func (c *Config) validateKafkaReplay() error {
+	switch c.KafkaStartOffset {
+	case "earliest", "latest":
+	default:
+		return fmt.Errorf("KAFKA_START_OFFSET must be one of earliest, latest; got %q", c.KafkaStartOffset)
+	}
+	if c.KafkaReplayOffsets == "" {
+		return nil
+	}
+	if !c.KafkaReplayFrom.IsZero() {
+		return fmt.Errorf("KAFKA_REPLAY_FROM and KAFKA_REPLAY_OFFSETS are mutually exclusive")
+	}
+
+	c.KafkaReplayPartitionOffsets = make(map[string]map[int]int64)
+	for _, entry := range strings.Split(c.KafkaReplayOffsets, ",") {
+		entry = strings.TrimSpace(entry)
+		partition, offset, ok := strings.Cut(entry, "=")
+		i := strings.LastIndex(partition, ":")
+		if !ok || i <= 0 {
+			return fmt.Errorf("KAFKA_REPLAY_OFFSETS entries must be topic:partition=offset; got %q", entry)
+		}
+		topic := partition[:i]
+		p, perr := strconv.Atoi(partition[i+1:])
+		o, oerr := strconv.ParseInt(offset, 10, 64)
+		if perr != nil || oerr != nil || p < 0 || o < 0 {
+			return fmt.Errorf("KAFKA_REPLAY_OFFSETS entries must be topic:partition=offset with non-negative integers; got %q", entry)
+		}
+		if c.KafkaReplayPartitionOffsets[topic] == nil {
+			c.KafkaReplayPartitionOffsets[topic] = make(map[int]int64)
+		}
+		c.KafkaReplayPartitionOffsets[topic][p] = o
+	}
+	return nil
+}
+
+func (c *Config) validateKafkaSecurity() error {
+	if !c.KafkaTLSEnabled && (c.KafkaTLSCAFile != "" || c.KafkaTLSCertFile != "" || c.KafkaTLSKeyFile != "" || c.KafkaTLSInsecureSkipVerify) {
+		return fmt.Errorf("KAFKA_TLS_* settings require KAFKA_TLS_ENABLED=true")
+	}
+	if (c.KafkaTLSCertFile == "") != (c.KafkaTLSKeyFile == "") {
+		return fmt.Errorf("KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE must be set together")
+	}
+
+	var err error
+	if c.KafkaSASLUsername, err = resolveSecret("KAFKA_SASL_USERNAME", c.KafkaSASLUsername, c.KafkaSASLUsernameFile); err != nil {
+		return err
+	}
+	if c.KafkaSASLPassword, err = resolveSecret("KAFKA_SASL_PASSWORD", c.KafkaSASLPassword, c.KafkaSASLPasswordFile); err != nil {
+		return err
+	}
+
+	c.KafkaSASLMechanism = strings.ToUpper(c.KafkaSASLMechanism)
+	switch c.KafkaSASLMechanism {
+	case "":
+		return nil
+	case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+	default:
+		return fmt.Errorf("KAFKA_SASL_MECHANISM must be one of PLAIN, SCRAM-SHA-256, SCRAM-SHA-512; got %q", c.KafkaSASLMechanism)
+	}
+	if c.KafkaSASLUsername == "" || c.KafkaSASLPassword == "" {
+		return fmt.Errorf("KAFKA_SASL_MECHANISM=%s requires KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD", c.KafkaSASLMechanism)
+	}
+	return nil
+}
+
+func (c *Config) validateElastic() error {
+	if (len(c.ElasticURLs) == 0) == (c.ElasticCloudID == "") {
+		return fmt.Errorf("exactly one of ELASTIC_URLS or ELASTIC_CLOUD_ID must be set")
+	}
+	for _, raw := range c.ElasticURLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("ELASTIC_URLS entry %q must be an http or https URL", raw)
+		}
+	}
+
+	var err error
+	if c.ElasticUsername, err = resolveSecret("ELASTIC_USERNAME", c.ElasticUsername, c.ElasticUsernameFile); err != nil {
+		return err
+	}
+	if c.ElasticPassword, err = resolveSecret("ELASTIC_PASSWORD", c.ElasticPassword, c.ElasticPasswordFile); err != nil {
+		return err
+	}
+	if c.ElasticAPIKey, err = resolveSecret("ELASTIC_API_KEY", c.ElasticAPIKey, c.ElasticAPIKeyFile); err != nil {
+		return err
+	}
+
+	if (c.ElasticUsername == "") != (c.ElasticPassword == "") {
+		return fmt.Errorf("ELASTIC_USERNAME and ELASTIC_PASSWORD must be set together")
+	}
+	if c.ElasticAPIKey != "" && c.ElasticUsername != "" {
+		return fmt.Errorf("ELASTIC_API_KEY and ELASTIC_USERNAME/ELASTIC_PASSWORD are mutually exclusive")
+	}
+	switch c.ElasticPayloadMapping {
+	case "flattened", "object", "disabled":
+	default:
+		return fmt.Errorf("ELASTIC_PAYLOAD_MAPPING must be one of flattened, object, disabled; got %q", c.ElasticPayloadMapping)
+	}
+	switch c.ElasticMappingDrift {
+	case "warn", "fail":
+	default:
+		return fmt.Errorf("ELASTIC_MAPPING_DRIFT must be one of warn, fail; got %q", c.ElasticMappingDrift)
+	}
+	if err := c.validateElasticVersion(); err != nil {
+		return err
+	}
+	if c.ElasticTemplateBootstrap && c.ElasticTemplateName == "" {
+		return fmt.Errorf("ELASTIC_TEMPLATE_NAME must not be empty when ELASTIC_TEMPLATE_BOOTSTRAP is enabled")
+	}
+	if c.ElasticCACertFile != "" {
+		if _, err := os.Stat(c.ElasticCACertFile); err != nil {
+			return fmt.Errorf("ELASTIC_CA_CERT_FILE: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateElasticVersion() error {
+	switch c.ElasticVersionType {
+	case "":
+		return nil
+	case "external", "external_gte":
+	default:
+		return fmt.Errorf("ELASTIC_VERSION_TYPE must be one of external, external_gte; got %q", c.ElasticVersionType)
+	}
+	if c.ElasticDataStream {
+		return fmt.Errorf("ELASTIC_VERSION_TYPE cannot be combined with ELASTIC_DATA_STREAM")
+	}
+	source := c.ElasticVersionSource
+	if source != "offset" &&
+		(!strings.HasPrefix(source, "metadata.") || source == "metadata.") &&
+		(!strings.HasPrefix(source, "payload.") || source == "payload.") {
+		return fmt.Errorf("ELASTIC_VERSION_SOURCE must be offset, metadata.<key> or payload.<path>; got %q", source)
+	}
+	// Offsets are only ordered within a partition, and those of different
+	// partitions overlap, so a document must only ever be written from one
+	// partition of one topic. Only the topic can be checked here; producers
+	// must key events by document to keep each on one partition.
+	if source == "offset" && (c.KafkaTopicPattern != "" || len(c.KafkaTopics) > 1) {
+		return fmt.Errorf("ELASTIC_VERSION_SOURCE=offset requires a single KAFKA_TOPIC, as offsets of different topics are unordered; use metadata.<key> or payload.<path>")
+	}
+	return nil
+}
+
+func (c *Config) validateRetry() error {
+	if c.RetryMaxAttempts <= 0 {
+		return fmt.Errorf("RETRY_MAX_ATTEMPTS must be positive, got %d", c.RetryMaxAttempts)
+	}
+	if c.RetryBaseDelay < 0 || c.RetryMaxDelay < 0 {
+		return fmt.Errorf("RETRY_BASE_DELAY and RETRY_MAX_DELAY must not be negative")
+	}
+	if c.RetryMultiplier < 1 {
+		return fmt.Errorf("RETRY_MULTIPLIER must be at least 1, got %g", c.RetryMultiplier)
+	}
+	if c.RetryJitter < 0 || c.RetryJitter > 1 {
+		return fmt.Errorf("RETRY_JITTER must be between 0 and 1, got %g", c.RetryJitter)
+	}
+	return nil
+}
+
+func (c *Config) validateBatch() error {
+	if c.BatchMaxSize <= 0 {
+		return fmt.Errorf("BATCH_MAX_SIZE must be positive, got %d", c.BatchMaxSize)
+	}
+	if c.BatchMaxBytes < 0 {
+		return fmt.Errorf("BATCH_MAX_BYTES must not be negative, got %d", c.BatchMaxBytes)
+	}
+	if c.BatchLinger < 0 {
+		return fmt.Errorf("BATCH_LINGER must not be negative, got %v", c.BatchLinger)
+	}
+	return nil
+}
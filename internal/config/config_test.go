@@ -2,13 +2,16 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadConfigFromEnv(t *testing.T) {
 	t.Setenv("KAFKA_BROKERS", "broker1:9092,broker2:9092")
 	t.Setenv("KAFKA_TOPIC", "orders")
 	t.Setenv("KAFKA_GROUP_ID", "orders-consumer")
+	t.Setenv("KAFKA_DLQ_TOPIC", "orders-dlq")
 	t.Setenv("ELASTIC_URLS", "http://es1:9200,http://es2:9200")
 	t.Setenv("ELASTIC_INDEX", "orders-index")
 	t.Setenv("WORKER_COUNT", "10")
@@ -25,12 +28,15 @@ func TestLoadConfigFromEnv(t *testing.T) {
 	if cfg.KafkaBrokers[0] != "broker1:9092" || cfg.KafkaBrokers[1] != "broker2:9092" {
 		t.Fatalf("unexpected kafka brokers: %#v", cfg.KafkaBrokers)
 	}
-	if cfg.KafkaTopic != "orders" {
-		t.Fatalf("expected KafkaTopic=orders, got %s", cfg.KafkaTopic)
+	if len(cfg.KafkaTopics) != 1 || cfg.KafkaTopics[0] != "orders" {
+		t.Fatalf("expected KafkaTopics=[orders], got %v", cfg.KafkaTopics)
 	}
 	if cfg.KafkaGroupID != "orders-consumer" {
 		t.Fatalf("expected KafkaGroupID=orders-consumer, got %s", cfg.KafkaGroupID)
 	}
+	if cfg.KafkaDLQTopic != "orders-dlq" {
+		t.Fatalf("expected KafkaDLQTopic=orders-dlq, got %s", cfg.KafkaDLQTopic)
+	}
 	if got, want := len(cfg.ElasticURLs), 2; got != want {
 		t.Fatalf("expected %d elastic urls, got %d", want, got)
 	}
@@ -52,6 +58,7 @@ func TestLoadConfigDefaults(t *testing.T) {
 	// Ensure env is clear for these keys.
 	_ = os.Unsetenv("KAFKA_TOPIC")
 	_ = os.Unsetenv("KAFKA_GROUP_ID")
+	_ = os.Unsetenv("KAFKA_DLQ_TOPIC")
 	_ = os.Unsetenv("ELASTIC_INDEX")
 	_ = os.Unsetenv("WORKER_COUNT")
 	_ = os.Unsetenv("LOG_LEVEL")
@@ -64,12 +71,15 @@ func TestLoadConfigDefaults(t *testing.T) {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	if cfg.KafkaTopic != "messages" {
-		t.Fatalf("expected default KafkaTopic=messages, got %s", cfg.KafkaTopic)
+	if len(cfg.KafkaTopics) != 1 || cfg.KafkaTopics[0] != "messages" {
+		t.Fatalf("expected default KafkaTopics=[messages], got %v", cfg.KafkaTopics)
 	}
 	if cfg.KafkaGroupID != "indexer-group" {
 		t.Fatalf("expected default KafkaGroupID=indexer-group, got %s", cfg.KafkaGroupID)
 	}
+	if cfg.KafkaDLQTopic != "messages-dlq" {
+		t.Fatalf("expected default KafkaDLQTopic=messages-dlq, got %s", cfg.KafkaDLQTopic)
+	}
 	if cfg.ElasticIndex != "messages" {
 		t.Fatalf("expected default ElasticIndex=messages, got %s", cfg.ElasticIndex)
 	}
@@ -79,5 +89,634 @@ func TestLoadConfigDefaults(t *testing.T) {
 	if cfg.LogLevel != "INFO" {
 		t.Fatalf("expected default LogLevel=INFO, got %s", cfg.LogLevel)
 	}
+	if cfg.AdminAddr != "localhost:8081" {
+		t.Fatalf("expected default AdminAddr=localhost:8081, got %s", cfg.AdminAddr)
+	}
+	if cfg.KafkaStatusHeader != "" || cfg.KafkaStatusPrecedence != "payload" {
+		t.Fatalf("expected no status header with payload precedence by default, got %q/%q", cfg.KafkaStatusHeader, cfg.KafkaStatusPrecedence)
+	}
+	if cfg.KafkaMetadataPrefix != "" {
+		t.Fatalf("expected record metadata to be off by default, got prefix %q", cfg.KafkaMetadataPrefix)
+	}
+}
+
+func TestLoadConfigRetryPolicy(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+	t.Setenv("RETRY_MAX_ATTEMPTS", "6")
+	t.Setenv("RETRY_BASE_DELAY", "50ms")
+	t.Setenv("RETRY_MULTIPLIER", "3")
+	t.Setenv("RETRY_JITTER", "0.1")
+	t.Setenv("RETRY_MAX_DELAY", "2s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cfg.RetryMaxAttempts != 6 {
+		t.Fatalf("expected RetryMaxAttempts=6, got %d", cfg.RetryMaxAttempts)
+	}
+	if cfg.RetryBaseDelay != 50*time.Millisecond {
+		t.Fatalf("expected RetryBaseDelay=50ms, got %v", cfg.RetryBaseDelay)
+	}
+	if cfg.RetryMultiplier != 3 {
+		t.Fatalf("expected RetryMultiplier=3, got %g", cfg.RetryMultiplier)
+	}
+	if cfg.RetryJitter != 0.1 {
+		t.Fatalf("expected RetryJitter=0.1, got %g", cfg.RetryJitter)
+	}
+	if cfg.RetryMaxDelay != 2*time.Second {
+		t.Fatalf("expected RetryMaxDelay=2s, got %v", cfg.RetryMaxDelay)
+	}
+}
+
+func TestLoadConfigRejectsInvalidRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{name: "zero attempts", key: "RETRY_MAX_ATTEMPTS", value: "0"},
+		{name: "negative base delay", key: "RETRY_BASE_DELAY", value: "-1s"},
+		{name: "multiplier below one", key: "RETRY_MULTIPLIER", value: "0.5"},
+		{name: "jitter above one", key: "RETRY_JITTER", value: "1.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KAFKA_BROKERS", "broker1:9092")
+			t.Setenv("ELASTIC_URLS", "http://es1:9200")
+			t.Setenv(tt.key, tt.value)
+
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestLoadConfigBatchBounds(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+	t.Setenv("BATCH_MAX_SIZE", "100")
+	t.Setenv("BATCH_MAX_BYTES", "1048576")
+	t.Setenv("BATCH_LINGER", "50ms")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cfg.BatchMaxSize != 100 {
+		t.Fatalf("expected BatchMaxSize=100, got %d", cfg.BatchMaxSize)
+	}
+	if cfg.BatchMaxBytes != 1048576 {
+		t.Fatalf("expected BatchMaxBytes=1048576, got %d", cfg.BatchMaxBytes)
+	}
+	if cfg.BatchLinger != 50*time.Millisecond {
+		t.Fatalf("expected BatchLinger=50ms, got %v", cfg.BatchLinger)
+	}
+
+	t.Setenv("BATCH_MAX_SIZE", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for BATCH_MAX_SIZE=0")
+	}
+}
+
+func TestLoadConfigDispatchMode(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+
+	_ = os.Unsetenv("DISPATCH_MODE")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.DispatchMode != "shared" {
+		t.Fatalf("expected default DispatchMode=shared, got %s", cfg.DispatchMode)
+	}
+
+	t.Setenv("DISPATCH_MODE", "key")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.DispatchMode != "key" {
+		t.Fatalf("expected DispatchMode=key, got %s", cfg.DispatchMode)
+	}
+
+	t.Setenv("DISPATCH_MODE", "random")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for DISPATCH_MODE=random")
+	}
+}
+
+func TestLoadConfigElasticRefresh(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+
+	_ = os.Unsetenv("ELASTIC_REFRESH")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.ElasticRefresh != "false" {
+		t.Fatalf("expected default ElasticRefresh=false, got %s", cfg.ElasticRefresh)
+	}
+
+	t.Setenv("ELASTIC_REFRESH", "wait_for")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.ElasticRefresh != "wait_for" {
+		t.Fatalf("expected ElasticRefresh=wait_for, got %s", cfg.ElasticRefresh)
+	}
+
+	t.Setenv("ELASTIC_REFRESH", "sometimes")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for ELASTIC_REFRESH=sometimes")
+	}
+}
+
+func TestLoadConfigRejectsInvalidLogLevel(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+
+	t.Setenv("LOG_LEVEL", "debug")
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected lower-case level to be accepted, got %v", err)
+	}
+
+	t.Setenv("LOG_LEVEL", "verbose")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for LOG_LEVEL=verbose")
+	}
+}
+
+func TestLoadConfigRejectsInvalidAdminAddr(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+	t.Setenv("ADMIN_ADDR", "8081")
+
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for ADMIN_ADDR without a port separator")
+	}
 }
 
+func TestLoadConfigKafkaSASLFromFiles(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+
+	dir := t.TempDir()
+	userFile := filepath.Join(dir, "username")
+	passFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(userFile, []byte("indexer\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(passFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("KAFKA_SASL_MECHANISM", "scram-sha-512")
+	t.Setenv("KAFKA_SASL_USERNAME_FILE", userFile)
+	t.Setenv("KAFKA_SASL_PASSWORD_FILE", passFile)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.KafkaSASLMechanism != "SCRAM-SHA-512" {
+		t.Fatalf("expected KafkaSASLMechanism=SCRAM-SHA-512, got %s", cfg.KafkaSASLMechanism)
+	}
+	if cfg.KafkaSASLUsername != "indexer" || cfg.KafkaSASLPassword != "s3cret" {
+		t.Fatalf("expected credentials from files, got %q/%q", cfg.KafkaSASLUsername, cfg.KafkaSASLPassword)
+	}
+
+	t.Setenv("KAFKA_SASL_PASSWORD", "inline")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error when KAFKA_SASL_PASSWORD and KAFKA_SASL_PASSWORD_FILE are both set")
+	}
+}
+
+func TestLoadConfigRejectsInvalidKafkaSecurity(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "unknown mechanism", env: map[string]string{"KAFKA_SASL_MECHANISM": "GSSAPI", "KAFKA_SASL_USERNAME": "u", "KAFKA_SASL_PASSWORD": "p"}},
+		{name: "mechanism without credentials", env: map[string]string{"KAFKA_SASL_MECHANISM": "PLAIN"}},
+		{name: "missing password file", env: map[string]string{"KAFKA_SASL_PASSWORD_FILE": "/does/not/exist"}},
+		{name: "tls file without tls enabled", env: map[string]string{"KAFKA_TLS_CA_FILE": "/etc/ca.pem"}},
+		{name: "cert without key", env: map[string]string{"KAFKA_TLS_ENABLED": "true", "KAFKA_TLS_CERT_FILE": "/etc/cert.pem"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KAFKA_BROKERS", "broker1:9092")
+			t.Setenv("ELASTIC_URLS", "http://es1:9200")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			if _, err := Load(); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadConfigElasticCloudAndAPIKeyFile(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "")
+
+	keyFile := filepath.Join(t.TempDir(), "api-key")
+	if err := os.WriteFile(keyFile, []byte("aWQ6a2V5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ELASTIC_CLOUD_ID", "deployment:ZXhhbXBsZS5jb20kYWJjJGRlZg==")
+	t.Setenv("ELASTIC_API_KEY_FILE", keyFile)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(cfg.ElasticURLs) != 0 {
+		t.Fatalf("expected no elastic urls, got %#v", cfg.ElasticURLs)
+	}
+	if cfg.ElasticAPIKey != "aWQ6a2V5" {
+		t.Fatalf("expected API key from file, got %q", cfg.ElasticAPIKey)
+	}
+}
+
+func TestLoadConfigRejectsInvalidElasticSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "no endpoint", env: map[string]string{"ELASTIC_URLS": ""}},
+		{name: "urls and cloud id", env: map[string]string{"ELASTIC_CLOUD_ID": "deployment:abc"}},
+		{name: "url without scheme", env: map[string]string{"ELASTIC_URLS": "es1:9200"}},
+		{name: "username without password", env: map[string]string{"ELASTIC_USERNAME": "elastic"}},
+		{name: "api key and basic auth", env: map[string]string{"ELASTIC_USERNAME": "elastic", "ELASTIC_PASSWORD": "changeme", "ELASTIC_API_KEY": "aWQ6a2V5"}},
+		{name: "password and password file", env: map[string]string{"ELASTIC_USERNAME": "elastic", "ELASTIC_PASSWORD": "changeme", "ELASTIC_PASSWORD_FILE": "/run/secrets/es"}},
+		{name: "missing ca cert file", env: map[string]string{"ELASTIC_CA_CERT_FILE": "/does/not/exist.pem"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KAFKA_BROKERS", "broker1:9092")
+			t.Setenv("ELASTIC_URLS", "https://es1:9200")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			if _, err := Load(); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadConfigElasticDataStream(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+
+	_ = os.Unsetenv("ELASTIC_DATA_STREAM")
+	_ = os.Unsetenv("ELASTIC_TIMESTAMP_FIELD")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.ElasticDataStream {
+		t.Fatal("expected data stream mode to be off by default")
+	}
+	if cfg.ElasticTimestampField != "timestamp" {
+		t.Fatalf("expected default ElasticTimestampField=timestamp, got %s", cfg.ElasticTimestampField)
+	}
+
+	t.Setenv("ELASTIC_DATA_STREAM", "true")
+	t.Setenv("ELASTIC_TIMESTAMP_FIELD", "event_time")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !cfg.ElasticDataStream || cfg.ElasticTimestampField != "event_time" {
+		t.Fatalf("expected data stream mode with event_time, got %v/%s", cfg.ElasticDataStream, cfg.ElasticTimestampField)
+	}
+}
+
+func TestLoadConfigElasticTemplateBootstrap(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.ElasticTemplateBootstrap || cfg.ElasticTemplateName != "kflow" {
+		t.Fatalf("expected template bootstrap disabled, named kflow, by default, got %v/%s", cfg.ElasticTemplateBootstrap, cfg.ElasticTemplateName)
+	}
+
+	t.Setenv("ELASTIC_TEMPLATE_BOOTSTRAP", "true")
+	if cfg, err = Load(); err != nil || !cfg.ElasticTemplateBootstrap {
+		t.Fatalf("expected template bootstrap to be enabled, got %v", err)
+	}
+	if cfg.ElasticPayloadMapping != "flattened" || cfg.ElasticMappingDrift != "warn" {
+		t.Fatalf("expected flattened payload and warn on drift by default, got %s/%s", cfg.ElasticPayloadMapping, cfg.ElasticMappingDrift)
+	}
+
+	t.Setenv("ELASTIC_PAYLOAD_MAPPING", "nested")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for ELASTIC_PAYLOAD_MAPPING=nested")
+	}
+
+	t.Setenv("ELASTIC_PAYLOAD_MAPPING", "object")
+	t.Setenv("ELASTIC_MAPPING_DRIFT", "ignore")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for ELASTIC_MAPPING_DRIFT=ignore")
+	}
+}
+
+func TestLoadConfigElasticVersion(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.ElasticVersionType != "" || cfg.ElasticVersionSource != "offset" {
+		t.Fatalf("expected versioning off with offset source by default, got %q/%q", cfg.ElasticVersionType, cfg.ElasticVersionSource)
+	}
+
+	t.Setenv("ELASTIC_VERSION_TYPE", "external_gte")
+	t.Setenv("ELASTIC_VERSION_SOURCE", "payload.updated_at")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.ElasticVersionType != "external_gte" || cfg.ElasticVersionSource != "payload.updated_at" {
+		t.Fatalf("expected external_gte from payload.updated_at, got %q/%q", cfg.ElasticVersionType, cfg.ElasticVersionSource)
+	}
+
+	tests := []struct {
+		name, key, value string
+	}{
+		{name: "internal version type", key: "ELASTIC_VERSION_TYPE", value: "internal"},
+		{name: "unknown source", key: "ELASTIC_VERSION_SOURCE", value: "timestamp"},
+		{name: "empty metadata key", key: "ELASTIC_VERSION_SOURCE", value: "metadata."},
+		{name: "data stream", key: "ELASTIC_DATA_STREAM", value: "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestLoadConfigOffsetVersionRequiresSingleTopic(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+	t.Setenv("ELASTIC_VERSION_TYPE", "external")
+	t.Setenv("ELASTIC_VERSION_SOURCE", "offset")
+
+	t.Setenv("KAFKA_TOPIC", "orders")
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected offset versioning of a single topic to be accepted, got %v", err)
+	}
+
+	t.Setenv("KAFKA_TOPIC", "orders,refunds")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for offset versioning of several topics")
+	}
+
+	t.Setenv("KAFKA_TOPIC", "orders")
+	t.Setenv("KAFKA_TOPIC_PATTERN", "^orders-.*")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for offset versioning of a topic pattern")
+	}
+}
+
+func TestLoadConfigKafkaStatusHeader(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+	t.Setenv("KAFKA_STATUS_HEADER", "x-status-code")
+	t.Setenv("KAFKA_STATUS_PRECEDENCE", "header")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.KafkaStatusHeader != "x-status-code" || cfg.KafkaStatusPrecedence != "header" {
+		t.Fatalf("expected x-status-code with header precedence, got %q/%q", cfg.KafkaStatusHeader, cfg.KafkaStatusPrecedence)
+	}
+
+	t.Setenv("KAFKA_STATUS_PRECEDENCE", "both")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for KAFKA_STATUS_PRECEDENCE=both")
+	}
+}
+
+func TestLoadConfigKafkaTopics(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+	t.Setenv("KAFKA_TOPIC", "orders, payments")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(cfg.KafkaTopics) != 2 || cfg.KafkaTopics[0] != "orders" || cfg.KafkaTopics[1] != "payments" {
+		t.Fatalf("expected KafkaTopics=[orders payments], got %v", cfg.KafkaTopics)
+	}
+	if cfg.KafkaTopicPattern != "" || cfg.KafkaTopicRefreshInterval != time.Minute {
+		t.Fatalf("expected no pattern with a 1m refresh by default, got %q/%v", cfg.KafkaTopicPattern, cfg.KafkaTopicRefreshInterval)
+	}
+
+	t.Setenv("KAFKA_TOPIC_PATTERN", `^events\.[a-z]+$`)
+	t.Setenv("KAFKA_TOPIC_REFRESH_INTERVAL", "30s")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.KafkaTopicPattern != `^events\.[a-z]+$` || cfg.KafkaTopicRefreshInterval != 30*time.Second {
+		t.Fatalf("expected pattern with a 30s refresh, got %q/%v", cfg.KafkaTopicPattern, cfg.KafkaTopicRefreshInterval)
+	}
+
+	tests := []struct {
+		name, key, value string
+	}{
+		{name: "invalid pattern", key: "KAFKA_TOPIC_PATTERN", value: "events.("},
+		{name: "pattern matches dlq", key: "KAFKA_TOPIC_PATTERN", value: "^messages"},
+		{name: "non-positive refresh", key: "KAFKA_TOPIC_REFRESH_INTERVAL", value: "0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+
+	t.Setenv("KAFKA_TOPIC_PATTERN", "")
+	for _, topics := range []string{"orders,,payments", "orders,messages-dlq"} {
+		t.Setenv("KAFKA_TOPIC", topics)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for KAFKA_TOPIC=%s", topics)
+		}
+	}
+}
+
+func TestLoadConfigKafkaReplay(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.KafkaStartOffset != "earliest" || !cfg.KafkaReplayFrom.IsZero() || cfg.KafkaReplayPartitionOffsets != nil {
+		t.Fatalf("expected earliest start offset without replay, got %q/%v/%v",
+			cfg.KafkaStartOffset, cfg.KafkaReplayFrom, cfg.KafkaReplayPartitionOffsets)
+	}
+
+	t.Setenv("KAFKA_START_OFFSET", "latest")
+	t.Setenv("KAFKA_REPLAY_FROM", "2024-03-09T12:00:00Z")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC); cfg.KafkaStartOffset != "latest" || !cfg.KafkaReplayFrom.Equal(want) {
+		t.Fatalf("expected latest start offset replaying from %v, got %q/%v", want, cfg.KafkaStartOffset, cfg.KafkaReplayFrom)
+	}
+
+	t.Setenv("KAFKA_REPLAY_FROM", "")
+	t.Setenv("KAFKA_REPLAY_OFFSETS", "orders:0=42, orders:1=0,payments:3=7")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got := cfg.KafkaReplayPartitionOffsets
+	if len(got) != 2 || got["orders"][0] != 42 || got["orders"][1] != 0 || got["payments"][3] != 7 {
+		t.Fatalf("unexpected replay offsets %v", got)
+	}
+
+	tests := []struct {
+		name, key, value string
+	}{
+		{name: "unknown start offset", key: "KAFKA_START_OFFSET", value: "newest"},
+		{name: "missing partition", key: "KAFKA_REPLAY_OFFSETS", value: "orders=42"},
+		{name: "missing offset", key: "KAFKA_REPLAY_OFFSETS", value: "orders:0"},
+		{name: "negative offset", key: "KAFKA_REPLAY_OFFSETS", value: "orders:0=-1"},
+		{name: "both replay modes", key: "KAFKA_REPLAY_FROM", value: "2024-03-09T12:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestLoadReplayConfig(t *testing.T) {
+	// Replay never connects to Elasticsearch, so ELASTIC_URLS is not needed.
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("KAFKA_TOPIC", "orders")
+	t.Setenv("KAFKA_REPLAY_OFFSETS", "orders:0=42")
+
+	if _, err := Load(); err == nil {
+		t.Fatal("expected Load to require Elasticsearch settings")
+	}
+	cfg, err := LoadReplay()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := cfg.KafkaReplayPartitionOffsets["orders"][0]; got != 42 {
+		t.Fatalf("expected replay offset 42, got %d", got)
+	}
+
+	tests := []struct {
+		name, key, value string
+	}{
+		{name: "no replay target", key: "KAFKA_REPLAY_OFFSETS", value: ""},
+		{name: "invalid replay offsets", key: "KAFKA_REPLAY_OFFSETS", value: "orders=42"},
+		{name: "no brokers", key: "KAFKA_BROKERS", value: ""},
+		{name: "empty topic", key: "KAFKA_TOPIC", value: "orders,"},
+		{name: "invalid log level", key: "LOG_LEVEL", value: "loud"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := LoadReplay(); err == nil {
+				t.Fatalf("expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestLoadConfigKafkaTuning(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "broker1:9092")
+	t.Setenv("ELASTIC_URLS", "http://es1:9200")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.KafkaMinBytes != 1 || cfg.KafkaMaxBytes != 1000000 || cfg.KafkaMaxWait != 10*time.Second {
+		t.Fatalf("unexpected fetch defaults %d/%d/%v", cfg.KafkaMinBytes, cfg.KafkaMaxBytes, cfg.KafkaMaxWait)
+	}
+	if cfg.KafkaSessionTimeout != 30*time.Second || cfg.KafkaHeartbeatInterval != 3*time.Second || cfg.KafkaRebalanceTimeout != 30*time.Second {
+		t.Fatalf("unexpected group defaults %v/%v/%v", cfg.KafkaSessionTimeout, cfg.KafkaHeartbeatInterval, cfg.KafkaRebalanceTimeout)
+	}
+	if cfg.KafkaIsolationLevel != "read_uncommitted" {
+		t.Fatalf("expected read_uncommitted by default, got %q", cfg.KafkaIsolationLevel)
+	}
+
+	t.Setenv("KAFKA_MIN_BYTES", "65536")
+	t.Setenv("KAFKA_MAX_BYTES", "10485760")
+	t.Setenv("KAFKA_MAX_WAIT", "500ms")
+	t.Setenv("KAFKA_SESSION_TIMEOUT", "45s")
+	t.Setenv("KAFKA_HEARTBEAT_INTERVAL", "5s")
+	t.Setenv("KAFKA_REBALANCE_TIMEOUT", "1m")
+	t.Setenv("KAFKA_ISOLATION_LEVEL", "read_committed")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.KafkaMinBytes != 65536 || cfg.KafkaMaxBytes != 10485760 || cfg.KafkaMaxWait != 500*time.Millisecond {
+		t.Fatalf("unexpected fetch settings %d/%d/%v", cfg.KafkaMinBytes, cfg.KafkaMaxBytes, cfg.KafkaMaxWait)
+	}
+	if cfg.KafkaSessionTimeout != 45*time.Second || cfg.KafkaHeartbeatInterval != 5*time.Second || cfg.KafkaRebalanceTimeout != time.Minute {
+		t.Fatalf("unexpected group settings %v/%v/%v", cfg.KafkaSessionTimeout, cfg.KafkaHeartbeatInterval, cfg.KafkaRebalanceTimeout)
+	}
+	if cfg.KafkaIsolationLevel != "read_committed" {
+		t.Fatalf("expected read_committed, got %q", cfg.KafkaIsolationLevel)
+	}
+
+	tests := []struct {
+		name, key, value string
+	}{
+		{name: "zero min bytes", key: "KAFKA_MIN_BYTES", value: "0"},
+		{name: "max below min bytes", key: "KAFKA_MAX_BYTES", value: "1024"},
+		{name: "zero max wait", key: "KAFKA_MAX_WAIT", value: "0s"},
+		{name: "heartbeat not below session timeout", key: "KAFKA_HEARTBEAT_INTERVAL", value: "45s"},
+		{name: "zero rebalance timeout", key: "KAFKA_REBALANCE_TIMEOUT", value: "0s"},
+		{name: "unknown isolation level", key: "KAFKA_ISOLATION_LEVEL", value: "serializable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// resolveSecret returns a secret given either inline through the variable
+// name or, through name_FILE, as the path to a file such as a mounted
+// Kubernetes secret. Trailing newlines in the file are ignored.
+func resolveSecret(name, value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("%s and %s_FILE are mutually exclusive", name, name)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("read %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
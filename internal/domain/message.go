@@ -18,6 +18,20 @@ const (
 	StatusCategoryServerError
 )
 
+// String returns a stable, label-friendly name for the category.
+func (c StatusCategory) String() string {
+	switch c {
+	case StatusCategorySuccess:
+		return "success"
+	case StatusCategoryClientError:
+		return "client_error"
+	case StatusCategoryServerError:
+		return "server_error"
+	default:
+		return "unknown"
+	}
+}
+
 // StatusCategory returns the category of the event's StatusCode.
 // A zero value status is treated as success (default forward-to-index behaviour).
 func (e MessageEvent) StatusCategory() StatusCategory {
@@ -58,3 +72,33 @@ func (e MessageEvent) ShouldDeadLetterWithoutRetry() bool {
 	return e.StatusCategory() == StatusCategoryClientError
 }
 
+// MetadataOperation is the metadata key naming the write an event requests
+// against its document; see Operation.
+const MetadataOperation = "op"
+
+// MetadataScript is the metadata key naming a stored script that update and
+// upsert operations run instead of merging the payload.
+const MetadataScript = "script"
+
+// Operation is the write an event requests against the document with its ID.
+type Operation string
+
+const (
+	// OperationIndex replaces the whole document. It is the default.
+	OperationIndex Operation = "index"
+	// OperationUpdate merges the event into an existing document.
+	OperationUpdate Operation = "update"
+	// OperationUpsert merges the event into the document, creating it if absent.
+	OperationUpsert Operation = "upsert"
+	// OperationDelete removes the document.
+	OperationDelete Operation = "delete"
+)
+
+// Operation returns the operation requested by the event's "op" metadata
+// entry, or OperationIndex when it is absent. The value is not validated.
+func (e MessageEvent) Operation() Operation {
+	if op := e.Metadata[MetadataOperation]; op != "" {
+		return Operation(op)
+	}
+	return OperationIndex
+}
@@ -29,6 +29,26 @@ func TestMessageEvent_StatusCategory(t *testing.T) {
 	}
 }
 
+func TestStatusCategory_String(t *testing.T) {
+	tests := []struct {
+		category StatusCategory
+		expected string
+	}{
+		{category: StatusCategorySuccess, expected: "success"},
+		{category: StatusCategoryClientError, expected: "client_error"},
+		{category: StatusCategoryServerError, expected: "server_error"},
+		{category: StatusCategoryUnknown, expected: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := tt.category.String(); got != tt.expected {
+				t.Fatalf("String() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestMessageEvent_IsRetriable(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -98,3 +118,25 @@ func TestMessageEvent_ShouldDeadLetterWithoutRetry(t *testing.T) {
 	}
 }
 
+func TestMessageEvent_Operation(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		expected Operation
+	}{
+		{name: "defaults to index", metadata: nil, expected: OperationIndex},
+		{name: "empty defaults to index", metadata: map[string]string{"op": ""}, expected: OperationIndex},
+		{name: "update", metadata: map[string]string{"op": "update"}, expected: OperationUpdate},
+		{name: "upsert", metadata: map[string]string{"op": "upsert"}, expected: OperationUpsert},
+		{name: "delete", metadata: map[string]string{"op": "delete"}, expected: OperationDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := MessageEvent{Metadata: tt.metadata}
+			if got := e.Operation(); got != tt.expected {
+				t.Fatalf("Operation() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Package httpapi provides the HTTP handlers exposed by the indexer for
+// probes and operations.
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+// Status values reported in health responses.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// CheckResult reports the health of a single dependency.
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthResponse is the JSON body returned by the health endpoints.
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Liveness returns a handler that reports the process as alive. It performs
+// no dependency checks so that a dependency outage does not restart pods.
+func Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, HealthResponse{Status: StatusOK})
+	})
+}
+
+// Readiness returns a handler that runs every check concurrently, bounded by
+// timeout, and responds 200 only if all of them pass.
+func Readiness(checks map[string]ports.HealthChecker, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		resp := HealthResponse{
+			Status: StatusOK,
+			Checks: make(map[string]CheckResult, len(checks)),
+		}
+
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for name, checker := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				result := CheckResult{Status: StatusOK}
+				if err := checker.HealthCheck(ctx); err != nil {
+					result = CheckResult{Status: StatusUnavailable, Error: err.Error()}
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				resp.Checks[name] = result
+				if result.Status != StatusOK {
+					resp.Status = StatusUnavailable
+				}
+			}()
+		}
+		wg.Wait()
+
+		code := http.StatusOK
+		if resp.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, resp)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
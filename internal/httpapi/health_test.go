@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+type mockHealthChecker struct {
+	mock.Mock
+}
+
+func (m *mockHealthChecker) HealthCheck(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func serveHealth(t *testing.T, h http.Handler) (int, HealthResponse) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var body HealthResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	return rec.Code, body
+}
+
+func TestLiveness(t *testing.T) {
+	code, body := serveHealth(t, Liveness())
+
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, StatusOK, body.Status)
+}
+
+func TestReadiness_AllChecksPass(t *testing.T) {
+	kafka := &mockHealthChecker{}
+	kafka.On("HealthCheck", mock.Anything).Return(nil)
+	es := &mockHealthChecker{}
+	es.On("HealthCheck", mock.Anything).Return(nil)
+
+	h := Readiness(map[string]ports.HealthChecker{"kafka": kafka, "elasticsearch": es}, time.Second)
+	code, body := serveHealth(t, h)
+
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, StatusOK, body.Status)
+	require.Equal(t, CheckResult{Status: StatusOK}, body.Checks["kafka"])
+	require.Equal(t, CheckResult{Status: StatusOK}, body.Checks["elasticsearch"])
+}
+
+func TestReadiness_FailingCheckReportsUnavailable(t *testing.T) {
+	kafka := &mockHealthChecker{}
+	kafka.On("HealthCheck", mock.Anything).Return(errors.New("broker unreachable"))
+	es := &mockHealthChecker{}
+	es.On("HealthCheck", mock.Anything).Return(nil)
+
+	h := Readiness(map[string]ports.HealthChecker{"kafka": kafka, "elasticsearch": es}, time.Second)
+	code, body := serveHealth(t, h)
+
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, StatusUnavailable, body.Status)
+	require.Equal(t, CheckResult{Status: StatusUnavailable, Error: "broker unreachable"}, body.Checks["kafka"])
+	require.Equal(t, CheckResult{Status: StatusOK}, body.Checks["elasticsearch"])
+}
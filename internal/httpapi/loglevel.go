@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// maxLogLevelBody bounds the size of a log level request body.
+const maxLogLevelBody = 1 << 10
+
+// LogLevelRequest is the JSON body accepted, and returned, by the log level
+// endpoint. Level is any value accepted by slog.Level, e.g. "DEBUG" or
+// "WARN+2".
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// ErrorResponse is the JSON body returned for rejected requests.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// LogLevel returns a handler that reports the current level on GET and
+// changes it on PUT, so that verbosity can be raised on a running instance
+// without a restart. Level changes are logged on logger.
+func LogLevel(level *slog.LevelVar, logger *slog.Logger) http.Handler {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req LogLevelRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLogLevelBody)).Decode(&req); err != nil {
+				code := http.StatusBadRequest
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					code = http.StatusRequestEntityTooLarge
+				}
+				writeJSON(w, code, ErrorResponse{Error: "decode request: " + err.Error()})
+				return
+			}
+
+			var next slog.Level
+			if err := next.UnmarshalText([]byte(req.Level)); err != nil {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+
+			if prev := level.Level(); prev != next {
+				level.Set(next)
+				logger.InfoContext(r.Context(), "log level changed", "from", prev.String(), "to", next.String())
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "method not allowed"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, LogLevelRequest{Level: level.Level().String()})
+	})
+}
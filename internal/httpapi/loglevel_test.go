@@ -0,0 +1,78 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func serveLogLevel(t *testing.T, h http.Handler, method, body string) (int, string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, "/", strings.NewReader(body)))
+
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	if rec.Code != http.StatusOK {
+		return rec.Code, ""
+	}
+
+	var resp LogLevelRequest
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	return rec.Code, resp.Level
+}
+
+func TestLogLevel_Get(t *testing.T) {
+	var level slog.LevelVar
+	level.Set(slog.LevelWarn)
+
+	code, got := serveLogLevel(t, LogLevel(&level, nil), http.MethodGet, "")
+
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "WARN", got)
+}
+
+func TestLogLevel_PutChangesLevel(t *testing.T) {
+	var level slog.LevelVar
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	code, got := serveLogLevel(t, LogLevel(&level, logger), http.MethodPut, `{"level":"debug"}`)
+
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "DEBUG", got)
+	require.Equal(t, slog.LevelDebug, level.Level())
+	require.Contains(t, logs.String(), `msg="log level changed" from=INFO to=DEBUG`)
+}
+
+func TestLogLevel_RejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		code   int
+	}{
+		{name: "unknown level", method: http.MethodPut, body: `{"level":"loud"}`, code: http.StatusBadRequest},
+		{name: "malformed body", method: http.MethodPut, body: `level=debug`, code: http.StatusBadRequest},
+		{name: "oversized body", method: http.MethodPut, body: `{"level":"debug","pad":"` + strings.Repeat("x", 2<<10) + `"}`, code: http.StatusRequestEntityTooLarge},
+		{name: "unsupported method", method: http.MethodDelete, code: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var level slog.LevelVar
+			level.Set(slog.LevelInfo)
+
+			code, _ := serveLogLevel(t, LogLevel(&level, nil), tt.method, tt.body)
+
+			require.Equal(t, tt.code, code)
+			require.Equal(t, slog.LevelInfo, level.Level())
+		})
+	}
+}
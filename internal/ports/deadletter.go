@@ -0,0 +1,35 @@
+package ports
+
+import "context"
+
+// DeadLetter describes a message that could not be processed and must be
+// parked on a dead letter queue together with its source coordinates.
+type DeadLetter struct {
+	// Value holds the original, undecoded record bytes.
+	Value []byte
+
+	// Key and Headers are those of the original record.
+	Key     []byte
+	Headers []Header
+
+	// Reason is a human-readable explanation of why the message was rejected.
+	Reason string
+
+	// StatusCode is the status code carried by the event, if any.
+	StatusCode int
+
+	Topic     string
+	Partition int
+	Offset    int64
+
+	// Attempts is the number of processing attempts made before dead-lettering.
+	Attempts int
+}
+
+// DeadLetterPublisher defines the system boundary for parking unprocessable
+// messages on a dead letter queue.
+type DeadLetterPublisher interface {
+	// Publish durably writes the dead letter. Callers must only commit the
+	// source offset once Publish has returned without error.
+	Publish(ctx context.Context, dl DeadLetter) error
+}
@@ -2,15 +2,63 @@ package ports
 
 import (
 	"context"
+	"errors"
+	"net/http"
 
 	"github.com/nimafallahian/go-workflow/internal/domain"
 )
 
+// ErrRetriable marks indexer failures that are transient and may succeed when
+// retried, such as throttling or server-side errors. Adapters wrap it with %w.
+var ErrRetriable = errors.New("retriable indexer error")
+
+// IndexOutcome classifies how the service must react to a single event's
+// indexing result.
+type IndexOutcome int
+
+const (
+	// IndexOutcomeSucceeded means the event is persisted (or was an idempotent
+	// 409 conflict) and may be acknowledged.
+	IndexOutcomeSucceeded IndexOutcome = iota
+	// IndexOutcomeRetriable means the event failed transiently (429/5xx).
+	IndexOutcomeRetriable
+	// IndexOutcomeRejected means the datastore refused the event itself, e.g.
+	// a mapping error, and retrying cannot succeed.
+	IndexOutcomeRejected
+)
+
+// IndexResult describes the outcome of indexing a single event.
+type IndexResult struct {
+	// Status is the HTTP-like status code reported for the event.
+	Status int
+
+	// ErrorType and Reason describe the failure, if any.
+	ErrorType string
+	Reason    string
+}
+
+// Outcome classifies the result per the Elasticsearch error mapping policy.
+func (r IndexResult) Outcome() IndexOutcome {
+	switch {
+	case r.Status == http.StatusConflict:
+		return IndexOutcomeSucceeded
+	case r.Status == http.StatusTooManyRequests, r.Status >= 500:
+		return IndexOutcomeRetriable
+	case r.Status >= 400:
+		return IndexOutcomeRejected
+	default:
+		return IndexOutcomeSucceeded
+	}
+}
+
 // DataIndexer defines the system boundary for indexing domain events into
 // a backing datastore such as Elasticsearch.
 type DataIndexer interface {
 	// Index requests that the given events be indexed. Implementations may use
 	// bulk semantics under the hood and must honour the provided context.
-	Index(ctx context.Context, events []domain.MessageEvent) error
+	//
+	// On success, it returns exactly one result per event, in the same order.
+	// A non-nil error means the request as a whole failed and no per-event
+	// outcome is known.
+	Index(ctx context.Context, events []domain.MessageEvent) ([]IndexResult, error)
 }
-
@@ -0,0 +1,28 @@
+package ports
+
+import "testing"
+
+func TestIndexResult_Outcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected IndexOutcome
+	}{
+		{name: "created succeeds", status: 201, expected: IndexOutcomeSucceeded},
+		{name: "ok succeeds", status: 200, expected: IndexOutcomeSucceeded},
+		{name: "conflict treated as success", status: 409, expected: IndexOutcomeSucceeded},
+		{name: "too many requests retriable", status: 429, expected: IndexOutcomeRetriable},
+		{name: "server error retriable", status: 503, expected: IndexOutcomeRetriable},
+		{name: "mapping error rejected", status: 400, expected: IndexOutcomeRejected},
+		{name: "not found rejected", status: 404, expected: IndexOutcomeRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := IndexResult{Status: tt.status}
+			if got := r.Outcome(); got != tt.expected {
+				t.Fatalf("Outcome() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
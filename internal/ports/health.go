@@ -0,0 +1,11 @@
+package ports
+
+import "context"
+
+// HealthChecker is implemented by adapters whose backing dependency must be
+// reachable for the service to be ready to do work.
+type HealthChecker interface {
+	// HealthCheck returns nil when the dependency is reachable and healthy.
+	// Implementations must honour the context deadline.
+	HealthCheck(ctx context.Context) error
+}
@@ -2,25 +2,91 @@ package ports
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"time"
 
 	"github.com/nimafallahian/go-workflow/internal/domain"
 )
 
+// ErrConsumerFatal marks consumer errors that restarting the consume loop
+// cannot recover from, such as authentication or authorisation failures.
+// Adapters wrap it with %w; any other terminal error is treated as transient.
+var ErrConsumerFatal = errors.New("fatal consumer error")
+
 // KafkaMessage represents a unit of work received from Kafka along with
 // a mechanism to commit its offset once processing has completed.
 type KafkaMessage struct {
 	Event domain.MessageEvent
 
-	// Commit commits the underlying Kafka message offset after successful processing.
+	// Poison is set when the record could not be decoded, in which case Event
+	// is zero-valued and Value holds the undecodable bytes.
+	Poison *PoisonError
+
+	// Value holds the raw record bytes the Event was decoded from.
+	Value []byte
+
+	// Key is the record key, if any.
+	Key []byte
+
+	// Topic, Partition and Offset identify the source record.
+	Topic     string
+	Partition int
+	Offset    int64
+
+	// Timestamp is the record timestamp, set by the producer or the broker
+	// depending on the topic configuration.
+	Timestamp time.Time
+
+	// Headers are the record headers, in the order they were produced.
+	Headers []Header
+
+	// Commit marks the message as processed after successful handling. The
+	// adapter only commits a partition's offset once every earlier message on
+	// that partition has been marked as well, so messages may be marked in
+	// any order. Messages must be marked before the context passed to Consume
+	// is cancelled.
 	Commit func(ctx context.Context) error
 }
 
+// Header is a key/value pair attached to a record. Keys need not be unique.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// LogAttrs returns the attributes that identify m on every log line about it:
+// event ID, source coordinates and status category.
+func (m KafkaMessage) LogAttrs() []slog.Attr {
+	return []slog.Attr{
+		slog.String("event_id", m.Event.ID),
+		slog.String("topic", m.Topic),
+		slog.Int("partition", m.Partition),
+		slog.Int64("offset", m.Offset),
+		slog.String("status_category", m.Event.StatusCategory().String()),
+	}
+}
+
+// PoisonError describes a record that could not be decoded into a domain
+// event. Such records cannot succeed on redelivery and must be dead-lettered.
+type PoisonError struct {
+	Err error
+}
+
+func (e *PoisonError) Error() string {
+	return "poison message: " + e.Err.Error()
+}
+
+func (e *PoisonError) Unwrap() error {
+	return e.Err
+}
+
 // MessageConsumer exposes a streaming interface for consuming Kafka messages.
 // Implementations must be goroutine-safe and compatible with select-based loops.
 type MessageConsumer interface {
 	// Consume returns a read-only channel of KafkaMessage instances and a channel
 	// for terminal errors from the consumer loop. Both channels must be closed
 	// when the provided context is cancelled or the consumer shuts down.
+	// Consume may be called again after a terminal error to resume consumption.
 	Consume(ctx context.Context) (<-chan KafkaMessage, <-chan error)
 }
-
@@ -0,0 +1,53 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+)
+
+// Metrics records pipeline telemetry. Implementations must be goroutine-safe.
+type Metrics interface {
+	// MessageConsumed counts a record read from the broker.
+	MessageConsumed(category domain.StatusCategory)
+
+	// MessageIndexed counts an event persisted by the indexer.
+	MessageIndexed(category domain.StatusCategory)
+
+	// MessageSkipped counts an event acknowledged without being indexed.
+	MessageSkipped(category domain.StatusCategory)
+
+	// MessageDeadLettered counts a message parked on the DLQ for reason.
+	MessageDeadLettered(category domain.StatusCategory, reason string)
+
+	// MessageRetried counts a retry of a message after a transient failure.
+	MessageRetried(category domain.StatusCategory)
+
+	// BulkCompleted observes the latency and size of a bulk request.
+	BulkCompleted(duration time.Duration, size int)
+
+	// InFlightAdd adjusts the number of messages currently being processed.
+	InFlightAdd(delta int)
+
+	// ConsumerLag reports how many records a partition is behind its high
+	// watermark.
+	ConsumerLag(topic string, partition int, lag int64)
+
+	// ConsumerLagRevoked drops the lag of a partition that is no longer
+	// assigned to this consumer.
+	ConsumerLagRevoked(topic string, partition int)
+}
+
+// NopMetrics is a Metrics implementation that discards everything. It is
+// the default for components constructed without metrics.
+type NopMetrics struct{}
+
+func (NopMetrics) MessageConsumed(domain.StatusCategory)             {}
+func (NopMetrics) MessageIndexed(domain.StatusCategory)              {}
+func (NopMetrics) MessageSkipped(domain.StatusCategory)              {}
+func (NopMetrics) MessageDeadLettered(domain.StatusCategory, string) {}
+func (NopMetrics) MessageRetried(domain.StatusCategory)              {}
+func (NopMetrics) BulkCompleted(time.Duration, int)                  {}
+func (NopMetrics) InFlightAdd(int)                                   {}
+func (NopMetrics) ConsumerLag(string, int, int64)                    {}
+func (NopMetrics) ConsumerLagRevoked(string, int)                    {}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+// shutdownFlushTimeout bounds how long a worker may spend flushing its
+// pending batch once the service context has been cancelled.
+const shutdownFlushTimeout = 10 * time.Second
+
+// BatchConfig bounds the micro-batches each worker sends to the indexer.
+// A batch is flushed as soon as any bound is reached.
+type BatchConfig struct {
+	// MaxSize is the maximum number of events per batch.
+	MaxSize int
+
+	// MaxBytes is the approximate maximum encoded size of a batch. Zero means
+	// no byte bound.
+	MaxBytes int
+
+	// Linger is the longest the oldest event in a batch may wait before the
+	// batch is flushed. Zero or less flushes every message immediately.
+	Linger time.Duration
+}
+
+// DefaultBatchConfig returns batch bounds suitable for production use.
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		MaxSize:  500,
+		MaxBytes: 5 << 20,
+		Linger:   200 * time.Millisecond,
+	}
+}
+
+func (c BatchConfig) normalize() BatchConfig {
+	if c.MaxSize <= 0 {
+		c.MaxSize = 1
+	}
+	if c.MaxBytes < 0 {
+		c.MaxBytes = 0
+	}
+	return c
+}
+
+// batch accumulates messages destined for a single bulk Index call.
+type batch struct {
+	cfg   BatchConfig
+	msgs  []ports.KafkaMessage
+	bytes int
+}
+
+func newBatch(cfg BatchConfig) *batch {
+	return &batch{
+		cfg:  cfg,
+		msgs: make([]ports.KafkaMessage, 0, cfg.MaxSize),
+	}
+}
+
+func (b *batch) len() int {
+	return len(b.msgs)
+}
+
+// fits reports whether msg can join the batch without exceeding MaxBytes.
+// An empty batch always accepts a message, however large.
+func (b *batch) fits(msg ports.KafkaMessage) bool {
+	if b.cfg.MaxBytes == 0 || len(b.msgs) == 0 {
+		return true
+	}
+	return b.bytes+messageSize(msg) <= b.cfg.MaxBytes
+}
+
+func (b *batch) add(msg ports.KafkaMessage) {
+	b.msgs = append(b.msgs, msg)
+	b.bytes += messageSize(msg)
+}
+
+// full reports whether the batch has reached one of its bounds.
+func (b *batch) full() bool {
+	if len(b.msgs) >= b.cfg.MaxSize {
+		return true
+	}
+	return b.cfg.MaxBytes > 0 && b.bytes >= b.cfg.MaxBytes
+}
+
+// take returns the accumulated messages and resets the batch.
+func (b *batch) take() []ports.KafkaMessage {
+	msgs := b.msgs
+	b.msgs = make([]ports.KafkaMessage, 0, b.cfg.MaxSize)
+	b.bytes = 0
+	return msgs
+}
+
+// messageSize approximates the encoded size of msg, preferring the raw
+// record bytes when the adapter provided them.
+func messageSize(msg ports.KafkaMessage) int {
+	if len(msg.Value) > 0 {
+		return len(msg.Value)
+	}
+	encoded, err := json.Marshal(msg.Event)
+	if err != nil {
+		return 0
+	}
+	return len(encoded)
+}
+
+// runWorker consumes msgCh, routing non-indexable messages immediately and
+// accumulating indexable ones into batches bounded by s.batchConfig.
+//
+// It returns an error, without draining msgCh, once a message could be
+// neither indexed nor dead-lettered. That message is left unacknowledged, so
+// its partition cannot commit past it until the consume loop restarts and
+// fetches it again.
+func (s *IndexerService) runWorker(ctx context.Context, msgCh <-chan ports.KafkaMessage) error {
+	b := newBatch(s.batchConfig)
+
+	linger := time.NewTimer(time.Hour)
+	linger.Stop()
+	defer linger.Stop()
+
+	// Messages still held on return, batched or awaiting a retry, are
+	// abandoned unacknowledged and fetched again once the consume loop
+	// restarts.
+	retries := newRetryQueue()
+	defer func() {
+		retries.stop()
+		if n := b.len() + retries.len(); n > 0 {
+			s.metrics.InFlightAdd(-n)
+		}
+	}()
+
+	flush := func(ctx context.Context) error {
+		linger.Stop()
+		if b.len() == 0 {
+			return nil
+		}
+		msgs := b.take()
+		defer s.metrics.InFlightAdd(-len(msgs))
+		return s.flush(ctx, msgs)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Finish the current batch before exiting.
+			shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownFlushTimeout)
+			defer cancel()
+			return flush(shutdownCtx)
+		case <-linger.C:
+			if err := flush(ctx); err != nil {
+				return err
+			}
+		case now := <-retries.timer.C:
+			due := retries.popDue(now)
+			if len(due) > 0 {
+				s.metrics.InFlightAdd(-len(due))
+			}
+			for _, r := range due {
+				if err := s.attemptServerError(ctx, retries, r); err != nil {
+					return err
+				}
+			}
+		case msg, ok := <-msgCh:
+			if !ok {
+				return flush(ctx)
+			}
+			s.metrics.InFlightAdd(1)
+			handled, err := s.route(ctx, retries, msg)
+			if handled {
+				s.metrics.InFlightAdd(-1)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if !b.fits(msg) {
+				if err := flush(ctx); err != nil {
+					s.metrics.InFlightAdd(-1)
+					return err
+				}
+			}
+			if b.len() == 0 && s.batchConfig.Linger > 0 {
+				linger.Reset(s.batchConfig.Linger)
+			}
+			b.add(msg)
+
+			if b.full() || s.batchConfig.Linger <= 0 {
+				if err := flush(ctx); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// flush indexes msgs in a single bulk call and settles every message by its
+// per-event result: successes are acknowledged, rejections are dead-lettered
+// individually, and transient failures are retried with backoff. In the
+// ordered dispatch modes, later successes sharing a partition or key with a
+// transient failure are retried along with it.
+//
+// A bulk request failing with a non-retriable error, or a dead letter that
+// cannot be published, leaves the affected messages unacknowledged and is
+// returned so that the consume loop restarts from the committed offsets.
+func (s *IndexerService) flush(ctx context.Context, msgs []ports.KafkaMessage) error {
+	pending := msgs
+	attempt := 0
+	var dlqErrs []error
+
+	// pendingIndexed marks the pending messages that were indexed but held
+	// back behind a retried message of the same partition or key.
+	pendingIndexed := make([]bool, len(pending))
+
+	attempts, err := s.retry(ctx, func(ctx context.Context) error {
+		if attempt++; attempt > 1 {
+			s.logger.DebugContext(ctx, "retrying bulk index", "attempt", attempt, "events", len(pending))
+			for _, msg := range pending {
+				s.metrics.MessageRetried(msg.Event.StatusCategory())
+			}
+		}
+
+		events := make([]domain.MessageEvent, len(pending))
+		for i, msg := range pending {
+			events[i] = s.indexedEvent(msg)
+		}
+
+		results, err := s.indexer.Index(ctx, events)
+		if err != nil {
+			s.logger.WarnContext(ctx, "bulk index request failed",
+				"attempt", attempt, "events", len(events), "error", err)
+			return err
+		}
+		if len(results) != len(pending) {
+			return fmt.Errorf("indexer returned %d results for %d events", len(results), len(pending))
+		}
+
+		var retry []ports.KafkaMessage
+		var retryIndexed []bool
+		held := make(map[string]bool)
+		for i, res := range results {
+			msg := pending[i]
+			key, ordered := orderingKey(s.dispatchMode, msg)
+			switch outcome := res.Outcome(); {
+			case outcome == ports.IndexOutcomeRetriable:
+				retry = append(retry, msg)
+				retryIndexed = append(retryIndexed, false)
+				if ordered {
+					held[key] = true
+				}
+			case outcome == ports.IndexOutcomeRejected:
+				if err := s.reject(ctx, msg, res, attempt); err != nil {
+					dlqErrs = append(dlqErrs, err)
+				}
+			case ordered && held[key]:
+				// Written ahead of an earlier event being retried; write it
+				// again after that one so the earlier event cannot win.
+				retry = append(retry, msg)
+				retryIndexed = append(retryIndexed, true)
+			default:
+				s.indexed(ctx, msg)
+			}
+		}
+
+		pending, pendingIndexed = retry, retryIndexed
+		if len(pending) > 0 {
+			return fmt.Errorf("%d of %d events failed transiently: %w", len(pending), len(results), ports.ErrRetriable)
+		}
+		return nil
+	})
+	if err != nil && !isRetriable(err) {
+		// Cancelled mid-retry: leave the events for the next run.
+		if ctx.Err() != nil {
+			return nil
+		}
+		s.logger.ErrorContext(ctx, "bulk index failed, restarting from the committed offsets",
+			"events", len(pending), "error", err)
+		return fmt.Errorf("bulk index: %w", err)
+	}
+	if err != nil {
+		for i, msg := range pending {
+			// Its last write already followed the failed event's.
+			if pendingIndexed[i] {
+				s.indexed(ctx, msg)
+				continue
+			}
+			if err := s.deadLetterExhausted(ctx, msg, attempts, err); err != nil {
+				dlqErrs = append(dlqErrs, err)
+			}
+		}
+	}
+	return errors.Join(dlqErrs...)
+}
+
+// indexed records msg as indexed and acknowledges it.
+func (s *IndexerService) indexed(ctx context.Context, msg ports.KafkaMessage) {
+	s.logger.LogAttrs(ctx, slog.LevelDebug, "message indexed", msg.LogAttrs()...)
+	s.metrics.MessageIndexed(msg.Event.StatusCategory())
+	s.ack(ctx, msg)
+}
+
+// indexedEvent returns the event sent to the indexer for msg: its decoded
+// event, with the record metadata, offset and timestamp requested by
+// recordMetadataPrefix, offsetMetadataKey and timestampMetadataKey added to a
+// copy of its metadata.
+func (s *IndexerService) indexedEvent(msg ports.KafkaMessage) domain.MessageEvent {
+	event := msg.Event
+	if s.recordMetadataPrefix == "" && s.offsetMetadataKey == "" && s.timestampMetadataKey == "" {
+		return event
+	}
+	event.Metadata = maps.Clone(event.Metadata)
+	if event.Metadata == nil {
+		event.Metadata = make(map[string]string)
+	}
+	if s.recordMetadataPrefix != "" {
+		maps.Copy(event.Metadata, recordMetadata(msg, s.recordMetadataPrefix))
+	}
+	if s.offsetMetadataKey != "" {
+		event.Metadata[s.offsetMetadataKey] = strconv.FormatInt(msg.Offset, 10)
+	}
+	if s.timestampMetadataKey != "" && !msg.Timestamp.IsZero() {
+		event.Metadata[s.timestampMetadataKey] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	return event
+}
+
+// recordMetadata returns the source coordinates, key, timestamp and headers
+// of msg as metadata entries whose keys start with prefix. Headers are named
+// "<prefix>header.<key>"; of repeated headers, the last one wins.
+func recordMetadata(msg ports.KafkaMessage, prefix string) map[string]string {
+	md := map[string]string{
+		prefix + "topic":     msg.Topic,
+		prefix + "partition": strconv.Itoa(msg.Partition),
+		prefix + "offset":    strconv.FormatInt(msg.Offset, 10),
+	}
+	if len(msg.Key) > 0 {
+		md[prefix+"key"] = string(msg.Key)
+	}
+	if !msg.Timestamp.IsZero() {
+		md[prefix+"timestamp"] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	for _, h := range msg.Headers {
+		md[prefix+"header."+h.Key] = string(h.Value)
+	}
+	return md
+}
+
+// reject parks a message the indexer refused on the DLQ and acknowledges it.
+func (s *IndexerService) reject(ctx context.Context, msg ports.KafkaMessage, res ports.IndexResult, attempts int) error {
+	detail := fmt.Sprintf("%d %s: %s", res.Status, res.ErrorType, res.Reason)
+	return s.deadLetterAndAck(ctx, msg, reasonRejected, detail, attempts)
+}
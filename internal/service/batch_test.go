@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+// newBatchTestMessages builds n indexable messages that report their
+// acknowledgement on ackCh.
+func newBatchTestMessages(n int, value []byte, ackCh chan<- string) []ports.KafkaMessage {
+	msgs := make([]ports.KafkaMessage, n)
+	for i := range msgs {
+		id := fmt.Sprintf("msg-%d", i)
+		msgs[i] = ports.KafkaMessage{
+			Event: domain.MessageEvent{ID: id, StatusCode: 200},
+			Value: value,
+			Commit: func(context.Context) error {
+				ackCh <- id
+				return nil
+			},
+		}
+	}
+	return msgs
+}
+
+func waitForAcks(t *testing.T, ackCh <-chan string, n int) []string {
+	t.Helper()
+	acked := make([]string, 0, n)
+	for len(acked) < n {
+		select {
+		case id := <-ackCh:
+			acked = append(acked, id)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for commits: got %d of %d", len(acked), n)
+		}
+	}
+	return acked
+}
+
+func TestIndexerService_BatchFlushedWhenFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil).Run(
+		func(args mock.Arguments) {
+			events := args.Get(1).([]domain.MessageEvent)
+			assert.Len(t, events, 3)
+		},
+	)
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithBatchSize(3), WithBatchLinger(time.Hour))...)
+
+	ackCh := make(chan string, 3)
+	go svc.Start(ctx)
+
+	for _, msg := range newBatchTestMessages(3, nil, ackCh) {
+		msgCh <- msg
+	}
+
+	acked := waitForAcks(t, ackCh, 3)
+	require.ElementsMatch(t, []string{"msg-0", "msg-1", "msg-2"}, acked)
+
+	cancel()
+
+	indexer.AssertNumberOfCalls(t, "Index", 1)
+}
+
+func TestIndexerService_BatchFlushedAfterLinger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil).Run(
+		func(args mock.Arguments) {
+			events := args.Get(1).([]domain.MessageEvent)
+			assert.Len(t, events, 2)
+		},
+	)
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithBatchSize(100), WithBatchLinger(20*time.Millisecond))...)
+
+	ackCh := make(chan string, 2)
+	go svc.Start(ctx)
+
+	// The channel stays open: only the linger timer can trigger the flush.
+	for _, msg := range newBatchTestMessages(2, nil, ackCh) {
+		msgCh <- msg
+	}
+
+	waitForAcks(t, ackCh, 2)
+
+	cancel()
+
+	indexer.AssertNumberOfCalls(t, "Index", 1)
+}
+
+func TestIndexerService_BatchSplitByBytes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil).Run(
+		func(args mock.Arguments) {
+			events := args.Get(1).([]domain.MessageEvent)
+			assert.Len(t, events, 1)
+		},
+	)
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithBatchSize(100), WithBatchBytes(10), WithBatchLinger(20*time.Millisecond))...)
+
+	ackCh := make(chan string, 2)
+	go svc.Start(ctx)
+
+	for _, msg := range newBatchTestMessages(2, []byte("12345678"), ackCh) {
+		msgCh <- msg
+	}
+
+	waitForAcks(t, ackCh, 2)
+
+	cancel()
+
+	indexer.AssertNumberOfCalls(t, "Index", 2)
+}
+
+func TestIndexerService_BatchFailureAcknowledgesNothing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).
+		Return(nil, errors.New("mapping exploded"))
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithBatchSize(2), WithBatchLinger(time.Hour))...)
+
+	ackCh := make(chan string, 2)
+	go svc.Start(ctx)
+
+	for _, msg := range newBatchTestMessages(2, nil, ackCh) {
+		msgCh <- msg
+	}
+
+	select {
+	case id := <-ackCh:
+		t.Fatalf("did not expect %s to be acknowledged on bulk failure", id)
+	case <-time.After(300 * time.Millisecond):
+		// expected path: no ack within this window
+	}
+
+	cancel()
+
+	indexer.AssertNumberOfCalls(t, "Index", 1)
+}
+
+func TestIndexerService_BatchFailureRestartsConsumeLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	firstMsgCh := make(chan ports.KafkaMessage, 1)
+	secondMsgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	// The first loop must be cancelled by the failed flush for the consumer
+	// to drop its reader; the second one sees the message again.
+	loopDone := make(chan struct{})
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(firstMsgCh), (<-chan error)(errCh)).
+		Run(func(args mock.Arguments) {
+			loopCtx := args.Get(0).(context.Context)
+			go func() {
+				<-loopCtx.Done()
+				close(loopDone)
+				close(firstMsgCh)
+			}()
+		}).Once()
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(secondMsgCh), (<-chan error)(errCh)).Once()
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).
+		Return(nil, errors.New("mapping exploded")).Once()
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil)
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithBatchSize(1))...)
+	svc.restartPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+
+	ackCh := make(chan string, 2)
+	go svc.Start(ctx)
+
+	firstMsgCh <- newBatchTestMessages(1, nil, ackCh)[0]
+
+	select {
+	case <-loopDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the failed flush to end the consume loop")
+	}
+
+	// Redelivered by the next loop's fresh reader.
+	secondMsgCh <- newBatchTestMessages(1, nil, ackCh)[0]
+
+	select {
+	case id := <-ackCh:
+		require.Equal(t, "msg-0", id)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the redelivered message to be acknowledged")
+	}
+
+	cancel()
+
+	consumer.AssertNumberOfCalls(t, "Consume", 2)
+	indexer.AssertNumberOfCalls(t, "Index", 2)
+}
+
+func TestIndexerService_BatchSettlesPerItemResults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return([]ports.IndexResult{
+		{Status: 201},
+		{Status: 400, ErrorType: "mapper_parsing_exception", Reason: "failed to parse field [payload.foo]"},
+		{Status: 429, ErrorType: "es_rejected_execution_exception"},
+	}, nil).Once()
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil).Run(
+		func(args mock.Arguments) {
+			events := args.Get(1).([]domain.MessageEvent)
+			if assert.Len(t, events, 1) {
+				assert.Equal(t, "msg-2", events[0].ID)
+			}
+		},
+	).Once()
+
+	dlq := &mockDeadLetterPublisher{}
+	dlq.On("Publish", mock.Anything, mock.AnythingOfType("ports.DeadLetter")).Return(nil).Run(
+		func(args mock.Arguments) {
+			dl := args.Get(1).(ports.DeadLetter)
+			assert.Contains(t, dl.Reason, "mapper_parsing_exception")
+			assert.Equal(t, 1, dl.Attempts)
+		},
+	).Once()
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithDeadLetterPublisher(dlq), WithBatchSize(3), WithBatchLinger(time.Hour))...)
+
+	ackCh := make(chan string, 3)
+	go svc.Start(ctx)
+
+	for _, msg := range newBatchTestMessages(3, nil, ackCh) {
+		msgCh <- msg
+	}
+
+	acked := waitForAcks(t, ackCh, 3)
+	require.Equal(t, []string{"msg-0", "msg-1", "msg-2"}, acked)
+
+	cancel()
+
+	indexer.AssertNumberOfCalls(t, "Index", 2)
+	dlq.AssertExpectations(t)
+}
+
+func TestIndexerService_OffsetMetadataAddedToIndexedEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil).Run(
+		func(args mock.Arguments) {
+			events := args.Get(1).([]domain.MessageEvent)
+			if assert.Len(t, events, 2) {
+				assert.Equal(t, map[string]string{"kafka.offset": "0"}, events[0].Metadata)
+				assert.Equal(t, map[string]string{"source": "test", "kafka.offset": "1"}, events[1].Metadata)
+			}
+		},
+	)
+
+	svc := NewIndexerService(consumer, indexer,
+		testOptions(WithBatchSize(2), WithBatchLinger(time.Hour), WithOffsetMetadata("kafka.offset"))...)
+
+	ackCh := make(chan string, 2)
+	go svc.Start(ctx)
+
+	msgs := newBatchTestMessages(2, nil, ackCh)
+	msgs[1].Offset = 1
+	msgs[1].Event.Metadata = map[string]string{"source": "test"}
+	for _, msg := range msgs {
+		msgCh <- msg
+	}
+
+	waitForAcks(t, ackCh, 2)
+	require.Equal(t, map[string]string{"source": "test"}, msgs[1].Event.Metadata, "the consumed event is left unchanged")
+
+	cancel()
+
+	indexer.AssertNumberOfCalls(t, "Index", 1)
+}
+
+func TestIndexerService_TimestampMetadataAddedToIndexedEvents(t *testing.T) {
+	svc := NewIndexerService(&mockMessageConsumer{}, &mockDataIndexer{},
+		testOptions(WithTimestampMetadata("kafka.timestamp"))...)
+
+	msg := ports.KafkaMessage{
+		Event:     domain.MessageEvent{ID: "msg-1", Metadata: map[string]string{"source": "test"}},
+		Timestamp: time.Date(2024, time.March, 9, 13, 0, 0, 0, time.FixedZone("CET", 3600)),
+	}
+	event := svc.indexedEvent(msg)
+	require.Equal(t, map[string]string{"source": "test", "kafka.timestamp": "2024-03-09T12:00:00Z"}, event.Metadata)
+	require.Equal(t, map[string]string{"source": "test"}, msg.Event.Metadata, "the consumed event is left unchanged")
+
+	// Records without a timestamp fall back to the ingestion time downstream.
+	event = svc.indexedEvent(ports.KafkaMessage{Event: domain.MessageEvent{ID: "msg-2"}})
+	require.Empty(t, event.Metadata)
+}
+
+func TestRecordMetadata(t *testing.T) {
+	msg := ports.KafkaMessage{
+		Key:       []byte("order-1"),
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Timestamp: time.Date(2024, time.March, 9, 13, 0, 0, 0, time.FixedZone("CET", 3600)),
+		Headers: []ports.Header{
+			{Key: "trace-id", Value: []byte("abc")},
+			{Key: "retry", Value: []byte("1")},
+			{Key: "retry", Value: []byte("2")},
+		},
+	}
+
+	require.Equal(t, map[string]string{
+		"kafka.topic":           "orders",
+		"kafka.partition":       "3",
+		"kafka.offset":          "42",
+		"kafka.key":             "order-1",
+		"kafka.timestamp":       "2024-03-09T12:00:00Z",
+		"kafka.header.trace-id": "abc",
+		"kafka.header.retry":    "2",
+	}, recordMetadata(msg, "kafka."))
+
+	require.Equal(t, map[string]string{
+		"topic":     "orders",
+		"partition": "0",
+		"offset":    "0",
+	}, recordMetadata(ports.KafkaMessage{Topic: "orders"}, ""), "key and timestamp are omitted when unset")
+}
+
+// inFlightMetrics sums the in-flight gauge deltas.
+type inFlightMetrics struct {
+	ports.NopMetrics
+	inFlight atomic.Int64
+}
+
+func (m *inFlightMetrics) InFlightAdd(delta int) { m.inFlight.Add(int64(delta)) }
+
+func TestIndexerService_WorkerErrorSettlesInFlightGauge(t *testing.T) {
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).
+		Return(nil, errors.New("mapping exploded"))
+
+	dlq := &mockDeadLetterPublisher{}
+	dlq.On("Publish", mock.Anything, mock.AnythingOfType("ports.DeadLetter")).Return(errors.New("broker down"))
+
+	tests := []struct {
+		name string
+		opts []Option
+		msgs []ports.KafkaMessage
+	}{
+		{
+			name: "route error with a batched message",
+			opts: []Option{WithBatchLinger(time.Hour)},
+			msgs: []ports.KafkaMessage{
+				{Event: domain.MessageEvent{ID: "msg-ok", StatusCode: 200}},
+				{Event: domain.MessageEvent{ID: "msg-4xx", StatusCode: 400}},
+			},
+		},
+		{
+			name: "flush error making room for a message",
+			opts: []Option{WithBatchLinger(time.Hour), WithBatchBytes(8)},
+			msgs: []ports.KafkaMessage{
+				{Event: domain.MessageEvent{ID: "msg-1", StatusCode: 200}, Value: []byte("12345")},
+				{Event: domain.MessageEvent{ID: "msg-2", StatusCode: 200}, Value: []byte("12345")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &inFlightMetrics{}
+			svc := NewIndexerService(&mockMessageConsumer{}, indexer, testOptions(append(tt.opts,
+				WithDeadLetterPublisher(dlq), WithMetrics(metrics))...)...)
+
+			msgCh := make(chan ports.KafkaMessage, len(tt.msgs))
+			for _, msg := range tt.msgs {
+				msgCh <- msg
+			}
+
+			require.Error(t, svc.runWorker(context.Background(), msgCh))
+			assert.Zero(t, metrics.inFlight.Load(), "in-flight gauge leaked")
+		})
+	}
+}
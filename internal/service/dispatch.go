@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+// DispatchMode selects how consumed messages are distributed across workers.
+//
+// In DispatchPartition and DispatchKey, events sharing a partition or key
+// are written in consumption order, retries included: once an event of a
+// bulk request must be retried, the later events of its partition or key in
+// that request are sent again after it, even if they were indexed, so that
+// none of them is overwritten by the retried one.
+type DispatchMode string
+
+const (
+	// DispatchShared lets every worker pull from one shared channel. It gives
+	// the best load balancing but no ordering guarantees.
+	DispatchShared DispatchMode = "shared"
+
+	// DispatchPartition pins every Kafka partition to a fixed worker,
+	// preserving per-partition ordering.
+	DispatchPartition DispatchMode = "partition"
+
+	// DispatchKey pins every message key (falling back to the event ID) to a
+	// fixed worker, preserving per-key ordering.
+	DispatchKey DispatchMode = "key"
+)
+
+// orderingKey returns the partition or key whose events mode keeps in order,
+// or false in DispatchShared.
+func orderingKey(mode DispatchMode, msg ports.KafkaMessage) (string, bool) {
+	switch mode {
+	case DispatchKey:
+		if len(msg.Key) > 0 {
+			return string(msg.Key), true
+		}
+		return msg.Event.ID, true
+	case DispatchPartition:
+		return msg.Topic + "/" + strconv.Itoa(msg.Partition), true
+	default:
+		return "", false
+	}
+}
+
+// workerFor returns the index of the worker that owns msg under mode.
+func workerFor(mode DispatchMode, msg ports.KafkaMessage, workers int) int {
+	h := fnv.New32a()
+
+	switch mode {
+	case DispatchKey:
+		if len(msg.Key) > 0 {
+			_, _ = h.Write(msg.Key)
+		} else {
+			_, _ = h.Write([]byte(msg.Event.ID))
+		}
+	default:
+		_, _ = h.Write([]byte(msg.Topic))
+		_, _ = h.Write(binary.BigEndian.AppendUint32(nil, uint32(msg.Partition)))
+	}
+
+	return int(h.Sum32() % uint32(workers))
+}
+
+// dispatch fans msgCh out onto one channel per worker so that all messages
+// sharing a partition or key are handled, in order, by the same worker. Each
+// channel buffers a full batch, so that a worker busy flushing or backing off
+// does not immediately stall the dispatcher and, with it, every other
+// worker. The returned channels are closed once msgCh is closed or ctx is
+// cancelled.
+func (s *IndexerService) dispatch(ctx context.Context, msgCh <-chan ports.KafkaMessage) []<-chan ports.KafkaMessage {
+	workerChs := make([]chan ports.KafkaMessage, s.workerCount)
+	out := make([]<-chan ports.KafkaMessage, s.workerCount)
+	for i := range workerChs {
+		workerChs[i] = make(chan ports.KafkaMessage, s.batchConfig.MaxSize)
+		out[i] = workerChs[i]
+	}
+
+	go func() {
+		defer func() {
+			for _, ch := range workerChs {
+				close(ch)
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgCh:
+				if !ok {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case workerChs[workerFor(s.dispatchMode, msg, s.workerCount)] <- msg:
+				}
+			}
+		}
+	}()
+
+	return out
+}
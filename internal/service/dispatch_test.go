@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+func TestWorkerFor(t *testing.T) {
+	const workers = 8
+
+	keyed := func(key string, partition int) ports.KafkaMessage {
+		return ports.KafkaMessage{Key: []byte(key), Topic: "messages", Partition: partition}
+	}
+
+	// Same key lands on the same worker regardless of partition.
+	require.Equal(t,
+		workerFor(DispatchKey, keyed("order-1", 0), workers),
+		workerFor(DispatchKey, keyed("order-1", 3), workers),
+	)
+
+	// Same partition lands on the same worker regardless of key.
+	require.Equal(t,
+		workerFor(DispatchPartition, keyed("order-1", 2), workers),
+		workerFor(DispatchPartition, keyed("order-2", 2), workers),
+	)
+
+	// Without a record key, the event ID is used.
+	byID := ports.KafkaMessage{Event: domain.MessageEvent{ID: "order-1"}}
+	require.Equal(t,
+		workerFor(DispatchKey, byID, workers),
+		workerFor(DispatchKey, keyed("order-1", 0), workers),
+	)
+
+	for i := 0; i < 100; i++ {
+		w := workerFor(DispatchKey, keyed(fmt.Sprintf("k-%d", i), 0), workers)
+		require.GreaterOrEqual(t, w, 0)
+		require.Less(t, w, workers)
+	}
+}
+
+func TestIndexerService_KeyDispatchPreservesPerKeyOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	var mu sync.Mutex
+	indexed := make(map[string][]int)
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil).Run(
+		func(args mock.Arguments) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, evt := range args.Get(1).([]domain.MessageEvent) {
+				key := evt.Metadata["key"]
+				indexed[key] = append(indexed[key], int(evt.Payload["seq"].(float64)))
+			}
+		},
+	)
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithWorkerCount(4), WithBatchSize(1), WithDispatchMode(DispatchKey))...)
+
+	const perKey = 20
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	ackCh := make(chan string, perKey*len(keys))
+	go svc.Start(ctx)
+
+	for seq := 0; seq < perKey; seq++ {
+		for _, key := range keys {
+			id := fmt.Sprintf("%s-%d", key, seq)
+			msgCh <- ports.KafkaMessage{
+				Key: []byte(key),
+				Event: domain.MessageEvent{
+					ID:         id,
+					Payload:    map[string]any{"seq": float64(seq)},
+					Metadata:   map[string]string{"key": key},
+					StatusCode: 200,
+				},
+				Commit: func(context.Context) error {
+					ackCh <- id
+					return nil
+				},
+			}
+		}
+	}
+
+	for i := 0; i < perKey*len(keys); i++ {
+		select {
+		case <-ackCh:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for commits: got %d of %d", i, perKey*len(keys))
+		}
+	}
+
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		require.Len(t, indexed[key], perKey)
+		for seq, got := range indexed[key] {
+			require.Equal(t, seq, got, "key %s indexed out of order", key)
+		}
+	}
+}
+
+func TestIndexerService_KeyDispatchRetriesLaterEventsOfRetriedKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	var mu sync.Mutex
+	var calls [][]string
+	record := func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		var ids []string
+		for _, evt := range args.Get(1).([]domain.MessageEvent) {
+			ids = append(ids, evt.ID)
+		}
+		calls = append(calls, ids)
+	}
+
+	// The first write of a-1 is throttled while b-1 and a-2 succeed.
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).
+		Return([]ports.IndexResult{{Status: 429}, {Status: 201}, {Status: 201}}, nil).Run(record).Once()
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).
+		Return(nil, nil).Run(record)
+
+	svc := NewIndexerService(consumer, indexer,
+		testOptions(WithBatchSize(3), WithBatchLinger(time.Hour), WithDispatchMode(DispatchKey))...)
+
+	ackCh := make(chan string, 3)
+	go svc.Start(ctx)
+
+	for _, m := range []struct{ id, key string }{{"a-1", "a"}, {"b-1", "b"}, {"a-2", "a"}} {
+		id := m.id
+		msgCh <- ports.KafkaMessage{
+			Key:   []byte(m.key),
+			Event: domain.MessageEvent{ID: id, StatusCode: 200},
+			Commit: func(context.Context) error {
+				ackCh <- id
+				return nil
+			},
+		}
+	}
+
+	for range 3 {
+		select {
+		case <-ackCh:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for commits")
+		}
+	}
+
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// a-2 is written again after the retried a-1, so it is not overwritten.
+	require.Equal(t, [][]string{{"a-1", "b-1", "a-2"}, {"a-1", "a-2"}}, calls)
+}
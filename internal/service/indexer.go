@@ -2,94 +2,295 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
+	"time"
 
-	"github.com/nimafallahian/go-workflow/internal/domain"
 	"github.com/nimafallahian/go-workflow/internal/ports"
 )
 
+// Dead letter reasons attached to messages parked on the DLQ. They double as
+// metric labels, so they must stay short and stable.
+const (
+	reasonUndecodable      = "undecodable"
+	reasonInvalidData      = "invalid_data"
+	reasonRetriesExhausted = "retries_exhausted"
+	reasonRejected         = "rejected"
+
+	// reasonDropped counts messages destined for the DLQ that were
+	// acknowledged without one configured.
+	reasonDropped = "dropped"
+)
+
+// errStreamEnded reports a consumer stream that closed without an error
+// while the service was still running. The consume loop is restarted.
+var errStreamEnded = errors.New("message stream ended unexpectedly")
+
 // IndexerService orchestrates reading messages from Kafka, applying domain
 // rules, indexing into the data store, and acknowledging offsets.
 type IndexerService struct {
-	consumer    ports.MessageConsumer
-	indexer     ports.DataIndexer
-	workerCount int
+	consumer     ports.MessageConsumer
+	indexer      ports.DataIndexer
+	deadLetters  ports.DeadLetterPublisher
+	workerCount  int
+	retryPolicy  RetryPolicy
+	batchConfig  BatchConfig
+	dispatchMode DispatchMode
+	metrics      ports.Metrics
+	logger       *slog.Logger
+
+	// recordMetadataPrefix, offsetMetadataKey and timestampMetadataKey, if
+	// set, add Kafka record metadata to the event sent to the indexer.
+	recordMetadataPrefix string
+	offsetMetadataKey    string
+	timestampMetadataKey string
+
+	// restartPolicy paces restarts of the consume loop after transient
+	// consumer errors. Only its backoff schedule is used.
+	restartPolicy RetryPolicy
 }
 
-// NewIndexerService constructs a new IndexerService.
-func NewIndexerService(consumer ports.MessageConsumer, indexer ports.DataIndexer, workerCount int) *IndexerService {
-	if workerCount <= 0 {
-		workerCount = 1
+// NewIndexerService constructs a new IndexerService. By default it runs a
+// single worker with DefaultRetryPolicy, DefaultBatchConfig and
+// DispatchShared, and without a DLQ.
+func NewIndexerService(consumer ports.MessageConsumer, indexer ports.DataIndexer, opts ...Option) *IndexerService {
+	s := &IndexerService{
+		consumer:     consumer,
+		indexer:      indexer,
+		workerCount:  1,
+		retryPolicy:  DefaultRetryPolicy(),
+		batchConfig:  DefaultBatchConfig(),
+		dispatchMode: DispatchShared,
+		metrics:      ports.NopMetrics{},
+		logger:       slog.New(slog.DiscardHandler),
+		restartPolicy: RetryPolicy{
+			BaseDelay:  time.Second,
+			Multiplier: 2,
+			Jitter:     0.2,
+			MaxDelay:   30 * time.Second,
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.workerCount <= 0 {
+		s.workerCount = 1
+	}
+	if s.dispatchMode == "" {
+		s.dispatchMode = DispatchShared
+	}
+	if s.metrics == nil {
+		s.metrics = ports.NopMetrics{}
 	}
-	return &IndexerService{
-		consumer:    consumer,
-		indexer:     indexer,
-		workerCount: workerCount,
+	if s.logger == nil {
+		s.logger = slog.New(slog.DiscardHandler)
 	}
+	s.retryPolicy = s.retryPolicy.normalize()
+	s.batchConfig = s.batchConfig.normalize()
+
+	return s
 }
 
-// Start begins consuming messages and processing them with a worker pool.
-// It blocks until the context is cancelled.
-func (s *IndexerService) Start(ctx context.Context) {
-	msgCh, errCh := s.consumer.Consume(ctx)
+// Start begins consuming messages and processing them with a worker pool,
+// where each worker indexes micro-batches via a single bulk call. Unless the
+// dispatch mode is DispatchShared, messages are pinned to workers by
+// partition or key.
+//
+// Transient consumer errors, and messages that could be neither indexed nor
+// dead-lettered, restart the consume loop with backoff. Start blocks until
+// the context is cancelled, returning nil, or until the consumer reports a
+// fatal error, which is returned.
+func (s *IndexerService) Start(ctx context.Context) error {
+	s.logger.InfoContext(ctx, "indexer service started",
+		"workers", s.workerCount, "dispatch_mode", s.dispatchMode,
+		"batch_max_size", s.batchConfig.MaxSize, "batch_linger", s.batchConfig.Linger)
+
+	restarts := 0
+	for {
+		started := time.Now()
+		err := s.consume(ctx)
+		if ctx.Err() != nil {
+			s.logger.InfoContext(ctx, "indexer service stopped")
+			return nil
+		}
+		if errors.Is(err, ports.ErrConsumerFatal) {
+			return fmt.Errorf("consumer failed: %w", err)
+		}
+
+		// A loop that ran for a while was healthy; start backing off afresh.
+		if time.Since(started) > s.restartPolicy.MaxDelay {
+			restarts = 0
+		}
+		restarts++
+
+		delay := s.restartPolicy.Backoff(restarts)
+		s.logger.WarnContext(ctx, "consume loop stopped, restarting",
+			"error", err, "restart", restarts, "backoff", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// consume runs one consume loop until the consumer's message channel is
+// closed, then returns the terminal error it reported, or errStreamEnded if
+// it reported none while ctx is still live. A worker
+// failing to settle a message ends the loop early with its error, so that
+// the next loop fetches the unacknowledged messages again.
+func (s *IndexerService) consume(ctx context.Context) error {
+	loopCtx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	// The stream outlives the loop: workers still acknowledge the messages
+	// they settle while shutting down, and the consumer only commits those
+	// once the stream's context is done.
+	streamCtx, endStream := context.WithCancel(context.WithoutCancel(ctx))
+	defer endStream()
+
+	msgCh, errCh := s.consumer.Consume(streamCtx)
+
+	workerChs := make([]<-chan ports.KafkaMessage, s.workerCount)
+	if s.dispatchMode == DispatchShared {
+		for i := range workerChs {
+			workerChs[i] = msgCh
+		}
+	} else {
+		workerChs = s.dispatch(loopCtx, msgCh)
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(s.workerCount)
 
-	for i := 0; i < s.workerCount; i++ {
+	for _, workerCh := range workerChs {
 		go func() {
 			defer wg.Done()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case msg, ok := <-msgCh:
-					if !ok {
-						return
-					}
-					s.handleMessage(ctx, msg)
-				}
+			if err := s.runWorker(loopCtx, workerCh); err != nil {
+				stop(err)
 			}
 		}()
 	}
 
-	// Drain error channel in a separate goroutine to avoid blocking producers.
-	go func() {
-		for range errCh {
-			// In this initial implementation we ignore adapter-level errors here.
-		}
-	}()
-
-	<-ctx.Done()
 	wg.Wait()
+
+	if err := context.Cause(loopCtx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errCh:
+		if err == nil {
+			// The stream ended without reporting why, e.g. a consumer
+			// closing its channels early; treat it as transient.
+			return errStreamEnded
+		}
+		return err
+	}
 }
 
-func (s *IndexerService) handleMessage(ctx context.Context, msg ports.KafkaMessage) {
+// route applies the status rules to messages that bypass indexing and
+// reports whether msg was fully handled. Indexable messages return false and
+// are left for the caller to batch; 5xx messages are scheduled on retries. A
+// handled message that could not be dead-lettered is returned as an error and
+// left unacknowledged.
+func (s *IndexerService) route(ctx context.Context, retries *retryQueue, msg ports.KafkaMessage) (bool, error) {
 	event := msg.Event
 
-	// 4xx / non-retriable: skip indexing but acknowledge to clear from queue.
+	// Poison messages can never be decoded; park the raw bytes on the DLQ.
+	if msg.Poison != nil {
+		return true, s.deadLetterAndAck(ctx, msg, reasonUndecodable, msg.Poison.Err.Error(), 1)
+	}
+
+	// 4xx / non-retriable: skip indexing and park on the DLQ. The offset is
+	// only acknowledged once the DLQ write has succeeded.
 	if event.ShouldDeadLetterWithoutRetry() {
-		if msg.Commit != nil {
-			_ = msg.Commit(ctx)
-		}
-		return
+		detail := fmt.Sprintf("client error status %d", event.StatusCode)
+		return true, s.deadLetterAndAck(ctx, msg, reasonInvalidData, detail, 1)
+	}
+
+	// 5xx: the producer reported a transient upstream failure. Hold the
+	// message back with exponential backoff and park it on the DLQ once the
+	// retry budget is exhausted. The backoff runs on the worker's retry
+	// queue so that it never stalls the messages behind it.
+	if event.IsRetriable() {
+		return true, s.attemptServerError(ctx, retries, serverErrorRetry{msg: msg})
 	}
 
 	// Messages that shouldn't be indexed are simply acknowledged.
 	if !event.ShouldIndex() {
-		if msg.Commit != nil {
-			_ = msg.Commit(ctx)
-		}
-		return
+		s.logger.LogAttrs(ctx, slog.LevelDebug, "message skipped", msg.LogAttrs()...)
+		s.metrics.MessageSkipped(event.StatusCategory())
+		s.ack(ctx, msg)
+		return true, nil
 	}
 
-	// Index message; on error, do not acknowledge so Kafka can redeliver.
-	if err := s.indexer.Index(ctx, []domain.MessageEvent{event}); err != nil {
-		return
+	return false, nil
+}
+
+// deadLetterExhausted parks a message whose retry budget ran out on the DLQ
+// and acknowledges it. Nothing is acknowledged if ctx was cancelled mid-retry.
+func (s *IndexerService) deadLetterExhausted(ctx context.Context, msg ports.KafkaMessage, attempts int, cause error) error {
+	if ctx.Err() != nil {
+		return nil
 	}
+	return s.deadLetterAndAck(ctx, msg, reasonRetriesExhausted, cause.Error(), attempts)
+}
+
+// deadLetterAndAck publishes msg to the DLQ and only acknowledges it once the
+// DLQ write has succeeded. A failed write is returned. Without a DLQ, msg is
+// acknowledged and counted as dropped.
+func (s *IndexerService) deadLetterAndAck(ctx context.Context, msg ports.KafkaMessage, reason, detail string, attempts int) error {
+	attrs := append(msg.LogAttrs(),
+		slog.String("reason", reason),
+		slog.String("detail", detail),
+		slog.Int("attempts", attempts),
+	)
 
-	if msg.Commit != nil {
-		_ = msg.Commit(ctx)
+	if s.deadLetters == nil {
+		s.logger.LogAttrs(ctx, slog.LevelWarn, "message dropped, no dead letter queue configured", attrs...)
+		s.metrics.MessageDeadLettered(msg.Event.StatusCategory(), reasonDropped)
+		s.ack(ctx, msg)
+		return nil
 	}
+
+	err := s.deadLetters.Publish(ctx, ports.DeadLetter{
+		Value:      msg.Value,
+		Key:        msg.Key,
+		Headers:    msg.Headers,
+		Reason:     reason + ": " + detail,
+		StatusCode: msg.Event.StatusCode,
+		Topic:      msg.Topic,
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+		Attempts:   attempts,
+	})
+	if err != nil {
+		s.logger.LogAttrs(ctx, slog.LevelError, "failed to publish to dead letter queue",
+			append(msg.LogAttrs(), slog.String("reason", reason), slog.Any("error", err))...)
+		return fmt.Errorf("publish to dead letter queue: %w", err)
+	}
+
+	s.logger.LogAttrs(ctx, slog.LevelWarn, "message dead-lettered", attrs...)
+	s.metrics.MessageDeadLettered(msg.Event.StatusCategory(), reason)
+	s.ack(ctx, msg)
+	return nil
 }
 
+// ack commits msg's offset, if the adapter provided a way to do so.
+func (s *IndexerService) ack(ctx context.Context, msg ports.KafkaMessage) {
+	if msg.Commit == nil {
+		return
+	}
+	if err := msg.Commit(ctx); err != nil {
+		s.logger.LogAttrs(ctx, slog.LevelError, "failed to commit offset",
+			append(msg.LogAttrs(), slog.Any("error", err))...)
+	}
+}
@@ -1,12 +1,18 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
@@ -14,6 +20,8 @@ import (
 	"github.com/nimafallahian/go-workflow/internal/ports"
 )
 
+var errTransient = fmt.Errorf("es 429: %w", ports.ErrRetriable)
+
 type mockMessageConsumer struct {
 	mock.Mock
 }
@@ -27,11 +35,48 @@ type mockDataIndexer struct {
 	mock.Mock
 }
 
-func (m *mockDataIndexer) Index(ctx context.Context, events []domain.MessageEvent) error {
+// Index returns the configured results, or a success result per event when
+// the expectation returns neither results nor an error.
+func (m *mockDataIndexer) Index(ctx context.Context, events []domain.MessageEvent) ([]ports.IndexResult, error) {
 	args := m.Called(ctx, events)
+	results, _ := args.Get(0).([]ports.IndexResult)
+	if results == nil && args.Error(1) == nil {
+		results = make([]ports.IndexResult, len(events))
+		for i := range results {
+			results[i].Status = 201
+		}
+	}
+	return results, args.Error(1)
+}
+
+type mockDeadLetterPublisher struct {
+	mock.Mock
+}
+
+func (m *mockDeadLetterPublisher) Publish(ctx context.Context, dl ports.DeadLetter) error {
+	args := m.Called(ctx, dl)
 	return args.Error(0)
 }
 
+func testRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		Multiplier:  2,
+	}
+}
+
+// testOptions returns fast retry and batching settings for tests, followed
+// by opts so that callers can override them.
+func testOptions(opts ...Option) []Option {
+	return append([]Option{
+		WithRetryPolicy(testRetryPolicy()),
+		WithBatchSize(10),
+		WithBatchBytes(1 << 20),
+		WithBatchLinger(10 * time.Millisecond),
+	}, opts...)
+}
+
 func TestIndexerService_ValidMessageIndexedAndAcknowledged(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -43,15 +88,16 @@ func TestIndexerService_ValidMessageIndexedAndAcknowledged(t *testing.T) {
 	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
 
 	indexer := &mockDataIndexer{}
-	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil).Run(
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil).Run(
 		func(args mock.Arguments) {
 			events := args.Get(1).([]domain.MessageEvent)
-			require.Len(t, events, 1)
-			require.Equal(t, "msg-1", events[0].ID)
+			if assert.Len(t, events, 1) {
+				assert.Equal(t, "msg-1", events[0].ID)
+			}
 		},
 	)
 
-	svc := NewIndexerService(consumer, indexer, 1)
+	svc := NewIndexerService(consumer, indexer, testOptions()...)
 
 	var commitMu sync.Mutex
 	committed := false
@@ -104,7 +150,7 @@ func TestIndexerService_ClientErrorMessageAcknowledgedNotIndexed(t *testing.T) {
 
 	indexer := &mockDataIndexer{}
 
-	svc := NewIndexerService(consumer, indexer, 1)
+	svc := NewIndexerService(consumer, indexer, testOptions()...)
 
 	ackCh := make(chan struct{}, 1)
 
@@ -148,9 +194,9 @@ func TestIndexerService_IndexerErrorDoesNotAcknowledge(t *testing.T) {
 
 	indexer := &mockDataIndexer{}
 	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).
-		Return(errors.New("elasticsearch 5xx"))
+		Return(nil, errors.New("elasticsearch 5xx"))
 
-	svc := NewIndexerService(consumer, indexer, 1)
+	svc := NewIndexerService(consumer, indexer, testOptions()...)
 
 	ackCh := make(chan struct{}, 1)
 
@@ -184,3 +230,566 @@ func TestIndexerService_IndexerErrorDoesNotAcknowledge(t *testing.T) {
 	consumer.AssertExpectations(t)
 }
 
+func TestIndexerService_ClientErrorMessageDeadLetteredThenAcknowledged(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+
+	raw := []byte(`{"id":"msg-4xx","status_code":422}`)
+
+	dlq := &mockDeadLetterPublisher{}
+	dlq.On("Publish", mock.Anything, mock.AnythingOfType("ports.DeadLetter")).Return(nil).Run(
+		func(args mock.Arguments) {
+			dl := args.Get(1).(ports.DeadLetter)
+			assert.Equal(t, raw, dl.Value)
+			assert.Equal(t, 422, dl.StatusCode)
+			assert.Equal(t, "messages", dl.Topic)
+			assert.Equal(t, 3, dl.Partition)
+			assert.Equal(t, int64(42), dl.Offset)
+			assert.Equal(t, 1, dl.Attempts)
+			assert.NotEmpty(t, dl.Reason)
+		},
+	)
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithDeadLetterPublisher(dlq))...)
+
+	ackCh := make(chan struct{}, 1)
+
+	msg := ports.KafkaMessage{
+		Event: domain.MessageEvent{
+			ID:         "msg-4xx",
+			StatusCode: 422,
+		},
+		Value:     raw,
+		Topic:     "messages",
+		Partition: 3,
+		Offset:    42,
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+
+	go svc.Start(ctx)
+
+	msgCh <- msg
+	close(msgCh)
+
+	select {
+	case <-ackCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for commit on dead-lettered message")
+	}
+
+	cancel()
+
+	dlq.AssertExpectations(t)
+	indexer.AssertNotCalled(t, "Index", mock.Anything, mock.Anything)
+}
+
+func TestIndexerService_DeadLetterFailureDoesNotAcknowledge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+
+	dlq := &mockDeadLetterPublisher{}
+	dlq.On("Publish", mock.Anything, mock.AnythingOfType("ports.DeadLetter")).
+		Return(errors.New("dlq unavailable"))
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithDeadLetterPublisher(dlq))...)
+
+	ackCh := make(chan struct{}, 1)
+
+	msg := ports.KafkaMessage{
+		Event: domain.MessageEvent{
+			ID:         "msg-4xx",
+			StatusCode: 400,
+		},
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+
+	go svc.Start(ctx)
+
+	msgCh <- msg
+	close(msgCh)
+
+	select {
+	case <-ackCh:
+		t.Fatal("did not expect message to be acknowledged when the DLQ write fails")
+	case <-time.After(500 * time.Millisecond):
+		// expected path: no ack within this window
+	}
+
+	cancel()
+
+	dlq.AssertExpectations(t)
+}
+
+func TestIndexerService_ServerErrorMessageRetriedThenDeadLettered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+
+	dlq := &mockDeadLetterPublisher{}
+	dlq.On("Publish", mock.Anything, mock.AnythingOfType("ports.DeadLetter")).Return(nil).Run(
+		func(args mock.Arguments) {
+			dl := args.Get(1).(ports.DeadLetter)
+			assert.Equal(t, 503, dl.StatusCode)
+			assert.Equal(t, 3, dl.Attempts)
+			assert.Contains(t, dl.Reason, reasonRetriesExhausted)
+		},
+	)
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithDeadLetterPublisher(dlq))...)
+
+	ackCh := make(chan struct{}, 1)
+
+	msg := ports.KafkaMessage{
+		Event: domain.MessageEvent{
+			ID:         "msg-5xx",
+			StatusCode: 503,
+		},
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+
+	go svc.Start(ctx)
+
+	msgCh <- msg
+	select {
+	case <-ackCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for commit on 5xx message")
+	}
+
+	cancel()
+
+	dlq.AssertExpectations(t)
+	indexer.AssertNotCalled(t, "Index", mock.Anything, mock.Anything)
+}
+
+func TestIndexerService_ServerErrorBackoffDoesNotBlockWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 2)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil)
+
+	dlq := &mockDeadLetterPublisher{}
+
+	// The 5xx message waits a minute for its retry; the message behind it
+	// must be indexed in the meantime.
+	svc := NewIndexerService(consumer, indexer, testOptions(
+		WithDeadLetterPublisher(dlq),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Minute}),
+	)...)
+
+	done := make(chan struct{})
+
+	go svc.Start(ctx)
+
+	msgCh <- ports.KafkaMessage{
+		Event:  domain.MessageEvent{ID: "msg-5xx", StatusCode: 503},
+		Commit: func(context.Context) error { return nil },
+	}
+	msgCh <- ports.KafkaMessage{
+		Event: domain.MessageEvent{ID: "msg-ok", StatusCode: 200},
+		Commit: func(context.Context) error {
+			close(done)
+			return nil
+		},
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for commit behind a 5xx message")
+	}
+
+	cancel()
+
+	dlq.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+}
+
+func TestIndexerService_RetriableIndexerErrorRetriedThenAcknowledged(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, errTransient).Once()
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil).Once()
+
+	dlq := &mockDeadLetterPublisher{}
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithDeadLetterPublisher(dlq))...)
+
+	ackCh := make(chan struct{}, 1)
+
+	msg := ports.KafkaMessage{
+		Event: domain.MessageEvent{
+			ID:         "msg-retry",
+			StatusCode: 200,
+		},
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+
+	go svc.Start(ctx)
+
+	msgCh <- msg
+	close(msgCh)
+
+	select {
+	case <-ackCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for commit after retry")
+	}
+
+	cancel()
+
+	indexer.AssertNumberOfCalls(t, "Index", 2)
+	dlq.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+}
+
+func TestIndexerService_RetriableIndexerErrorExhaustedDeadLettered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, errTransient)
+
+	dlq := &mockDeadLetterPublisher{}
+	dlq.On("Publish", mock.Anything, mock.AnythingOfType("ports.DeadLetter")).Return(nil).Run(
+		func(args mock.Arguments) {
+			dl := args.Get(1).(ports.DeadLetter)
+			assert.Equal(t, 3, dl.Attempts)
+		},
+	)
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithDeadLetterPublisher(dlq))...)
+
+	ackCh := make(chan struct{}, 1)
+
+	msg := ports.KafkaMessage{
+		Event: domain.MessageEvent{
+			ID:         "msg-exhausted",
+			StatusCode: 200,
+		},
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+
+	go svc.Start(ctx)
+
+	msgCh <- msg
+	close(msgCh)
+
+	select {
+	case <-ackCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for commit after exhausting retries")
+	}
+
+	cancel()
+
+	indexer.AssertNumberOfCalls(t, "Index", 3)
+	dlq.AssertExpectations(t)
+}
+
+func TestIndexerService_PoisonMessageDeadLetteredThenAcknowledged(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+
+	raw := []byte(`{"id": "msg-broken", "payload": `)
+
+	dlq := &mockDeadLetterPublisher{}
+	dlq.On("Publish", mock.Anything, mock.AnythingOfType("ports.DeadLetter")).Return(nil).Run(
+		func(args mock.Arguments) {
+			dl := args.Get(1).(ports.DeadLetter)
+			assert.Equal(t, raw, dl.Value)
+			assert.Contains(t, dl.Reason, reasonUndecodable)
+			assert.Equal(t, int64(9), dl.Offset)
+			assert.Equal(t, []byte("key-1"), dl.Key)
+			assert.Equal(t, []ports.Header{{Key: "trace-id", Value: []byte("abc")}}, dl.Headers)
+		},
+	)
+
+	svc := NewIndexerService(consumer, indexer, testOptions(WithDeadLetterPublisher(dlq))...)
+
+	ackCh := make(chan struct{}, 1)
+
+	msg := ports.KafkaMessage{
+		Poison:  &ports.PoisonError{Err: errors.New("unexpected end of JSON input")},
+		Value:   raw,
+		Key:     []byte("key-1"),
+		Offset:  9,
+		Headers: []ports.Header{{Key: "trace-id", Value: []byte("abc")}},
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+
+	go svc.Start(ctx)
+
+	msgCh <- msg
+	close(msgCh)
+
+	select {
+	case <-ackCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for commit on poison message")
+	}
+
+	cancel()
+
+	dlq.AssertExpectations(t)
+	indexer.AssertNotCalled(t, "Index", mock.Anything, mock.Anything)
+}
+
+type mockMetrics struct {
+	mock.Mock
+}
+
+func (m *mockMetrics) MessageConsumed(category domain.StatusCategory) { m.Called(category) }
+func (m *mockMetrics) MessageIndexed(category domain.StatusCategory)  { m.Called(category) }
+func (m *mockMetrics) MessageSkipped(category domain.StatusCategory)  { m.Called(category) }
+func (m *mockMetrics) MessageRetried(category domain.StatusCategory)  { m.Called(category) }
+func (m *mockMetrics) InFlightAdd(delta int)                          { m.Called(delta) }
+func (m *mockMetrics) BulkCompleted(duration time.Duration, size int) { m.Called(duration, size) }
+
+func (m *mockMetrics) MessageDeadLettered(category domain.StatusCategory, reason string) {
+	m.Called(category, reason)
+}
+
+func (m *mockMetrics) ConsumerLag(topic string, partition int, lag int64) {
+	m.Called(topic, partition, lag)
+}
+
+func (m *mockMetrics) ConsumerLagRevoked(topic string, partition int) {
+	m.Called(topic, partition)
+}
+
+func TestIndexerService_RecordsMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 2)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil)
+
+	metrics := &mockMetrics{}
+	metrics.On("InFlightAdd", 1).Twice()
+	metrics.On("InFlightAdd", -1).Twice()
+	metrics.On("MessageIndexed", domain.StatusCategorySuccess).Once()
+	metrics.On("MessageDeadLettered", domain.StatusCategoryClientError, reasonInvalidData).Once()
+
+	dlq := &mockDeadLetterPublisher{}
+	dlq.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+	svc := NewIndexerService(consumer, indexer,
+		testOptions(WithBatchSize(1), WithMetrics(metrics), WithDeadLetterPublisher(dlq))...)
+
+	ackCh := make(chan struct{}, 2)
+	commit := func(context.Context) error {
+		ackCh <- struct{}{}
+		return nil
+	}
+
+	go svc.Start(ctx)
+
+	msgCh <- ports.KafkaMessage{Event: domain.MessageEvent{ID: "msg-ok", StatusCode: 200}, Commit: commit}
+	msgCh <- ports.KafkaMessage{Event: domain.MessageEvent{ID: "msg-4xx", StatusCode: 400}, Commit: commit}
+	close(msgCh)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ackCh:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for commits")
+		}
+	}
+
+	cancel()
+
+	require.Eventually(t, func() bool {
+		return metrics.AssertExpectations(&testing.T{})
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestIndexerService_CountsDropsWithoutDeadLetterQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	metrics := &mockMetrics{}
+	metrics.On("InFlightAdd", mock.Anything)
+	metrics.On("MessageDeadLettered", domain.StatusCategoryClientError, reasonDropped).Once()
+
+	svc := NewIndexerService(consumer, &mockDataIndexer{}, testOptions(WithMetrics(metrics))...)
+
+	ackCh := make(chan struct{}, 1)
+	go svc.Start(ctx)
+
+	msgCh <- ports.KafkaMessage{
+		Event: domain.MessageEvent{ID: "msg-4xx", StatusCode: 400},
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+
+	select {
+	case <-ackCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the dropped message to be acknowledged")
+	}
+
+	cancel()
+
+	require.Eventually(t, func() bool {
+		return metrics.AssertExpectations(&testing.T{})
+	}, time.Second, 10*time.Millisecond)
+}
+
+// syncBuffer is a goroutine-safe log sink for inspecting worker log output.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestIndexerService_LogsMessageFields(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh))
+
+	var logs syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	dlq := &mockDeadLetterPublisher{}
+	dlq.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+	svc := NewIndexerService(consumer, &mockDataIndexer{}, testOptions(WithLogger(logger), WithDeadLetterPublisher(dlq))...)
+
+	ackCh := make(chan struct{}, 1)
+	go svc.Start(ctx)
+
+	msgCh <- ports.KafkaMessage{
+		Event:     domain.MessageEvent{ID: "msg-4xx", StatusCode: 404},
+		Topic:     "messages",
+		Partition: 2,
+		Offset:    7,
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+	close(msgCh)
+
+	select {
+	case <-ackCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for commit on dead-lettered message")
+	}
+
+	var entry map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		if entry["msg"] == "message dead-lettered" {
+			break
+		}
+		entry = nil
+	}
+	require.NotNil(t, entry, "expected a dead-lettered log line in:\n%s", logs.String())
+
+	require.Equal(t, "WARN", entry["level"])
+	require.Equal(t, "msg-4xx", entry["event_id"])
+	require.Equal(t, "messages", entry["topic"])
+	require.EqualValues(t, 2, entry["partition"])
+	require.EqualValues(t, 7, entry["offset"])
+	require.Equal(t, "client_error", entry["status_category"])
+	require.Equal(t, reasonInvalidData, entry["reason"])
+}
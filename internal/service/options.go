@@ -0,0 +1,106 @@
+package service
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+// Option configures an IndexerService.
+type Option func(*IndexerService)
+
+// WithDeadLetterPublisher parks rejected and exhausted messages on p. Without
+// one, messages destined for the DLQ are acknowledged and dropped.
+func WithDeadLetterPublisher(p ports.DeadLetterPublisher) Option {
+	return func(s *IndexerService) {
+		s.deadLetters = p
+	}
+}
+
+// WithWorkerCount sets the number of workers indexing concurrently.
+func WithWorkerCount(n int) Option {
+	return func(s *IndexerService) {
+		s.workerCount = n
+	}
+}
+
+// WithRetryPolicy sets the backoff schedule for 5xx events and transient
+// indexer errors.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(s *IndexerService) {
+		s.retryPolicy = p
+	}
+}
+
+// WithBatchSize caps the number of events per bulk request.
+func WithBatchSize(n int) Option {
+	return func(s *IndexerService) {
+		s.batchConfig.MaxSize = n
+	}
+}
+
+// WithBatchBytes caps the approximate encoded size of a bulk request. Zero
+// disables the limit.
+func WithBatchBytes(n int) Option {
+	return func(s *IndexerService) {
+		s.batchConfig.MaxBytes = n
+	}
+}
+
+// WithBatchLinger bounds how long an event waits for its batch to fill.
+func WithBatchLinger(d time.Duration) Option {
+	return func(s *IndexerService) {
+		s.batchConfig.Linger = d
+	}
+}
+
+// WithDispatchMode sets how messages are spread across workers.
+func WithDispatchMode(m DispatchMode) Option {
+	return func(s *IndexerService) {
+		s.dispatchMode = m
+	}
+}
+
+// WithRecordMetadata merges the Kafka record metadata of each message into
+// the metadata of the event sent to the indexer, under keys starting with
+// prefix: topic, partition, offset, key, timestamp (RFC 3339) and
+// header.<name> for each header. Record entries replace event entries of the
+// same name. Dead-lettered messages keep their original bytes.
+func WithRecordMetadata(prefix string) Option {
+	return func(s *IndexerService) {
+		s.recordMetadataPrefix = prefix
+	}
+}
+
+// WithOffsetMetadata records each message's Kafka offset under key in the
+// metadata of the event sent to the indexer, e.g. for use as an external
+// document version. Dead-lettered messages keep their original bytes.
+func WithOffsetMetadata(key string) Option {
+	return func(s *IndexerService) {
+		s.offsetMetadataKey = key
+	}
+}
+
+// WithTimestampMetadata records each message's Kafka timestamp, as RFC 3339,
+// under key in the metadata of the event sent to the indexer, e.g. for use as
+// the data stream @timestamp.
+func WithTimestampMetadata(key string) Option {
+	return func(s *IndexerService) {
+		s.timestampMetadataKey = key
+	}
+}
+
+// WithMetrics records pipeline metrics on m.
+func WithMetrics(m ports.Metrics) Option {
+	return func(s *IndexerService) {
+		s.metrics = m
+	}
+}
+
+// WithLogger sets the logger used by the service.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *IndexerService) {
+		s.logger = l
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIndexerService_Defaults(t *testing.T) {
+	svc := NewIndexerService(&mockMessageConsumer{}, &mockDataIndexer{})
+
+	assert.Equal(t, 1, svc.workerCount)
+	assert.Equal(t, DefaultRetryPolicy(), svc.retryPolicy)
+	assert.Equal(t, DefaultBatchConfig(), svc.batchConfig)
+	assert.Equal(t, DispatchShared, svc.dispatchMode)
+	assert.Nil(t, svc.deadLetters)
+	assert.NotNil(t, svc.metrics)
+	assert.NotNil(t, svc.logger)
+}
+
+func TestNewIndexerService_AppliesOptions(t *testing.T) {
+	dlq := &mockDeadLetterPublisher{}
+	svc := NewIndexerService(&mockMessageConsumer{}, &mockDataIndexer{},
+		WithDeadLetterPublisher(dlq),
+		WithWorkerCount(8),
+		WithRetryPolicy(testRetryPolicy()),
+		WithBatchSize(50),
+		WithBatchBytes(1024),
+		WithBatchLinger(time.Second),
+		WithDispatchMode(DispatchPartition),
+		WithRecordMetadata("kafka."),
+		WithOffsetMetadata("kafka.offset"),
+		WithTimestampMetadata("kafka.timestamp"),
+		WithMetrics(nil),
+		WithLogger(nil),
+	)
+
+	assert.Same(t, dlq, svc.deadLetters)
+	assert.Equal(t, 8, svc.workerCount)
+	assert.Equal(t, 3, svc.retryPolicy.MaxAttempts)
+	assert.Equal(t, BatchConfig{MaxSize: 50, MaxBytes: 1024, Linger: time.Second}, svc.batchConfig)
+	assert.Equal(t, DispatchPartition, svc.dispatchMode)
+	assert.Equal(t, "kafka.", svc.recordMetadataPrefix)
+	assert.Equal(t, "kafka.offset", svc.offsetMetadataKey)
+	assert.Equal(t, "kafka.timestamp", svc.timestampMetadataKey)
+	assert.NotNil(t, svc.metrics, "nil metrics falls back to a no-op")
+	assert.NotNil(t, svc.logger, "nil logger falls back to a discard logger")
+}
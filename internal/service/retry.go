@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+// errUpstreamServerError marks events whose status code reports a transient
+// (5xx) failure upstream.
+var errUpstreamServerError = errors.New("upstream server error status")
+
+// RetryPolicy describes an exponential backoff schedule for retriable work.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+
+	// Multiplier scales the delay after every retry.
+	Multiplier float64
+
+	// Jitter randomises each delay by up to ±Jitter (a fraction in [0, 1]).
+	Jitter float64
+
+	// MaxDelay caps the delay between attempts. Zero means no cap.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy returns the policy mandated by the Kafka spec: the first
+// attempt plus 3 exponentially backed-off retries.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   200 * time.Millisecond,
+		Multiplier:  2,
+		Jitter:      0.2,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+func (p RetryPolicy) normalize() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 1
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 1
+	}
+	p.Jitter = min(max(p.Jitter, 0), 1)
+	return p
+}
+
+// Backoff returns the delay to wait before the given retry, where retry 1 is
+// the first attempt after the initial one.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	p = p.normalize()
+	if retry <= 0 || p.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := float64(p.BaseDelay)
+	for i := 1; i < retry; i++ {
+		delay *= p.Multiplier
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			break
+		}
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	return time.Duration(delay)
+}
+
+// isRetriable reports whether err is worth retrying under the retry policy.
+func isRetriable(err error) bool {
+	return errors.Is(err, ports.ErrRetriable) || errors.Is(err, errUpstreamServerError)
+}
+
+// retry runs fn until it succeeds, fails with a non-retriable error, exhausts
+// the policy, or ctx is cancelled. It returns the number of attempts made and
+// the last error observed.
+func (s *IndexerService) retry(ctx context.Context, fn func(ctx context.Context) error) (int, error) {
+	policy := s.retryPolicy.normalize()
+
+	var err error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(policy.Backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return attempt - 1, ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		if err = fn(ctx); err == nil || !isRetriable(err) {
+			return attempt, err
+		}
+	}
+	return policy.MaxAttempts, err
+}
+
+// serverErrorRetry is a 5xx message waiting in a worker's retryQueue for its
+// next attempt.
+type serverErrorRetry struct {
+	msg      ports.KafkaMessage
+	attempts int
+	due      time.Time
+}
+
+// retryQueue holds the 5xx messages of one worker between attempts, so that
+// backing off never blocks the messages queued behind them. Its timer fires
+// when the earliest retry is due.
+type retryQueue struct {
+	pending []serverErrorRetry
+	timer   *time.Timer
+}
+
+func newRetryQueue() *retryQueue {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return &retryQueue{timer: timer}
+}
+
+func (q *retryQueue) len() int { return len(q.pending) }
+
+// push schedules r and re-arms the timer for the earliest due retry.
+func (q *retryQueue) push(r serverErrorRetry) {
+	q.pending = append(q.pending, r)
+	q.arm()
+}
+
+// popDue removes and returns the retries due at now, in the order they were
+// scheduled.
+func (q *retryQueue) popDue(now time.Time) []serverErrorRetry {
+	var due []serverErrorRetry
+	kept := q.pending[:0]
+	for _, r := range q.pending {
+		if r.due.After(now) {
+			kept = append(kept, r)
+		} else {
+			due = append(due, r)
+		}
+	}
+	clear(q.pending[len(kept):])
+	q.pending = kept
+	q.arm()
+	return due
+}
+
+func (q *retryQueue) arm() {
+	q.timer.Stop()
+	if len(q.pending) == 0 {
+		return
+	}
+	next := q.pending[0].due
+	for _, r := range q.pending[1:] {
+		if r.due.Before(next) {
+			next = r.due
+		}
+	}
+	q.timer.Reset(time.Until(next))
+}
+
+func (q *retryQueue) stop() { q.timer.Stop() }
+
+// attemptServerError makes the next attempt at a 5xx message. The status is
+// part of the event, so every attempt fails; until the retry policy is
+// exhausted the message is rescheduled on q with backoff, after which it is
+// parked on the DLQ. A dead letter that cannot be published is returned.
+func (s *IndexerService) attemptServerError(ctx context.Context, q *retryQueue, r serverErrorRetry) error {
+	policy := s.retryPolicy.normalize()
+	event := r.msg.Event
+
+	if r.attempts++; r.attempts > 1 {
+		s.logger.LogAttrs(ctx, slog.LevelDebug, "retrying upstream server error",
+			append(r.msg.LogAttrs(), slog.Int("attempt", r.attempts))...)
+		s.metrics.MessageRetried(event.StatusCategory())
+	}
+
+	if r.attempts < policy.MaxAttempts {
+		r.due = time.Now().Add(policy.Backoff(r.attempts))
+		q.push(r)
+		s.metrics.InFlightAdd(1)
+		return nil
+	}
+
+	cause := fmt.Errorf("%w: %d", errUpstreamServerError, event.StatusCode)
+	return s.deadLetterExhausted(ctx, r.msg, r.attempts, cause)
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   100 * time.Millisecond,
+		Multiplier:  2,
+		MaxDelay:    300 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name     string
+		retry    int
+		expected time.Duration
+	}{
+		{name: "no delay before first attempt", retry: 0, expected: 0},
+		{name: "first retry uses base delay", retry: 1, expected: 100 * time.Millisecond},
+		{name: "second retry multiplies", retry: 2, expected: 200 * time.Millisecond},
+		{name: "third retry capped", retry: 3, expected: 300 * time.Millisecond},
+		{name: "later retries stay capped", retry: 10, expected: 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Backoff(tt.retry); got != tt.expected {
+				t.Fatalf("Backoff(%d) = %v, expected %v", tt.retry, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_BackoffJitterWithinBounds(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		Multiplier:  2,
+		Jitter:      0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		got := policy.Backoff(2)
+		if got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("Backoff(2) = %v, expected within [100ms, 300ms]", got)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
+)
+
+// failedStream returns closed channels carrying a single terminal error, as
+// a consumer does when its loop dies.
+func failedStream(err error) (<-chan ports.KafkaMessage, <-chan error) {
+	msgCh := make(chan ports.KafkaMessage)
+	errCh := make(chan error, 1)
+	errCh <- err
+	close(msgCh)
+	close(errCh)
+	return msgCh, errCh
+}
+
+func TestIndexerService_TransientConsumerErrorRestartsConsumeLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failedMsgCh, failedErrCh := failedStream(errors.New("broker connection reset"))
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return(failedMsgCh, failedErrCh).Once()
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh)).Once()
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil)
+
+	svc := NewIndexerService(consumer, indexer, testOptions()...)
+	svc.restartPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- svc.Start(ctx) }()
+
+	ackCh := make(chan struct{}, 1)
+	msgCh <- ports.KafkaMessage{
+		Event: domain.MessageEvent{ID: "msg-after-restart", StatusCode: 200},
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+
+	select {
+	case <-ackCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for commit after consumer restart")
+	}
+
+	cancel()
+
+	select {
+	case err := <-startErr:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for Start to return")
+	}
+
+	consumer.AssertNumberOfCalls(t, "Consume", 2)
+}
+
+func TestIndexerService_FatalConsumerErrorReturnedFromStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failedMsgCh, failedErrCh := failedStream(fmt.Errorf("%w: SASL authentication failed", ports.ErrConsumerFatal))
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return(failedMsgCh, failedErrCh).Once()
+
+	indexer := &mockDataIndexer{}
+
+	svc := NewIndexerService(consumer, indexer, testOptions()...)
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- svc.Start(ctx) }()
+
+	select {
+	case err := <-startErr:
+		require.ErrorIs(t, err, ports.ErrConsumerFatal)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for Start to return a fatal error")
+	}
+
+	consumer.AssertNumberOfCalls(t, "Consume", 1)
+}
+
+func TestIndexerService_StreamEndWithoutErrorRestartsConsumeLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A stream closed without an error while the service is running.
+	endedMsgCh := make(chan ports.KafkaMessage)
+	endedErrCh := make(chan error)
+	close(endedMsgCh)
+	close(endedErrCh)
+
+	msgCh := make(chan ports.KafkaMessage, 1)
+	errCh := make(chan error)
+
+	consumer := &mockMessageConsumer{}
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(endedMsgCh), (<-chan error)(endedErrCh)).Once()
+	consumer.On("Consume", mock.Anything).Return((<-chan ports.KafkaMessage)(msgCh), (<-chan error)(errCh)).Once()
+
+	indexer := &mockDataIndexer{}
+	indexer.On("Index", mock.Anything, mock.AnythingOfType("[]domain.MessageEvent")).Return(nil, nil)
+
+	svc := NewIndexerService(consumer, indexer, testOptions()...)
+	svc.restartPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- svc.Start(ctx) }()
+
+	ackCh := make(chan struct{}, 1)
+	msgCh <- ports.KafkaMessage{
+		Event: domain.MessageEvent{ID: "msg-after-restart", StatusCode: 200},
+		Commit: func(context.Context) error {
+			ackCh <- struct{}{}
+			return nil
+		},
+	}
+
+	select {
+	case <-ackCh:
+	case err := <-startErr:
+		t.Fatalf("Start returned %v instead of restarting the consume loop", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for commit after the stream ended")
+	}
+
+	cancel()
+
+	select {
+	case err := <-startErr:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for Start to return")
+	}
+
+	consumer.AssertNumberOfCalls(t, "Consume", 2)
+}
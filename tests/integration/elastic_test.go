@@ -14,22 +14,19 @@ import (
 
 	adapterses "github.com/nimafallahian/go-workflow/internal/adapters/es"
 	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
 )
 
-func TestElasticsearchIndexerIndexesMessageEvent(t *testing.T) {
-	// If Docker is not available, skip Elasticsearch integration tests.
-	if _, err := os.Stat("/var/run/docker.sock"); err != nil {
-		t.Skip("docker not available")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
+// startElasticsearch runs a single-node Elasticsearch container for the
+// duration of the test and returns a client connected to it.
+func startElasticsearch(ctx context.Context, t *testing.T) *elasticclient.Client {
+	t.Helper()
 
 	req := testcontainers.ContainerRequest{
 		Image:        "docker.elastic.co/elasticsearch/elasticsearch:8.9.0",
 		ExposedPorts: []string{"9200/tcp"},
 		Env: map[string]string{
-			"discovery.type":        "single-node",
+			"discovery.type":         "single-node",
 			"xpack.security.enabled": "false",
 		},
 		WaitingFor: wait.ForHTTP("/_cluster/health").
@@ -42,7 +39,7 @@ func TestElasticsearchIndexerIndexesMessageEvent(t *testing.T) {
 		Started:          true,
 	})
 	require.NoError(t, err)
-	defer func() { _ = esContainer.Terminate(context.Background()) }()
+	t.Cleanup(func() { _ = esContainer.Terminate(context.Background()) })
 
 	endpoint, err := esContainer.PortEndpoint(ctx, "9200", "http")
 	require.NoError(t, err)
@@ -52,9 +49,23 @@ func TestElasticsearchIndexerIndexesMessageEvent(t *testing.T) {
 	}
 	es, err := elasticclient.NewClient(clientCfg)
 	require.NoError(t, err)
+	return es
+}
+
+func TestElasticsearchIndexerIndexesMessageEvent(t *testing.T) {
+	// If Docker is not available, skip Elasticsearch integration tests.
+	if _, err := os.Stat("/var/run/docker.sock"); err != nil {
+		t.Skip("docker not available")
+	}
 
-	indexer, err := adapterses.NewIndexer(es, "messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	es := startElasticsearch(ctx, t)
+
+	indexer, err := adapterses.NewIndexer(es, "messages", adapterses.WithRefresh(adapterses.RefreshWaitFor))
 	require.NoError(t, err)
+	require.NoError(t, indexer.HealthCheck(ctx))
 
 	event := domain.MessageEvent{
 		ID: "msg-es-1",
@@ -67,8 +78,10 @@ func TestElasticsearchIndexerIndexesMessageEvent(t *testing.T) {
 		StatusCode: 200,
 	}
 
-	err = indexer.Index(ctx, []domain.MessageEvent{event})
+	results, err := indexer.Index(ctx, []domain.MessageEvent{event})
 	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, ports.IndexOutcomeSucceeded, results[0].Outcome())
 
 	// Wait a brief moment; refresh=wait_for should already have made the doc visible.
 	time.Sleep(2 * time.Second)
@@ -86,6 +99,76 @@ func TestElasticsearchIndexerIndexesMessageEvent(t *testing.T) {
 	err = json.NewDecoder(res.Body).Decode(&body)
 	require.NoError(t, err)
 	require.True(t, body.Found, "expected document to be found")
+
+	// A document whose payload conflicts with the existing mapping is rejected
+	// individually while the rest of the batch succeeds.
+	conflicting := domain.MessageEvent{
+		ID:         "msg-es-2",
+		Payload:    map[string]any{"foo": map[string]any{"nested": true}},
+		StatusCode: 200,
+	}
+	valid := domain.MessageEvent{
+		ID:         "msg-es-3",
+		Payload:    map[string]any{"foo": "baz"},
+		StatusCode: 200,
+	}
+
+	results, err = indexer.Index(ctx, []domain.MessageEvent{conflicting, valid})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, ports.IndexOutcomeRejected, results[0].Outcome())
+	require.NotEmpty(t, results[0].ErrorType)
+	require.Equal(t, ports.IndexOutcomeSucceeded, results[1].Outcome())
 }
 
+func TestElasticsearchBootstrapInstallsTemplates(t *testing.T) {
+	// If Docker is not available, skip Elasticsearch integration tests.
+	if _, err := os.Stat("/var/run/docker.sock"); err != nil {
+		t.Skip("docker not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
 
+	es := startElasticsearch(ctx, t)
+
+	// An index created before the template exists keeps its dynamic mapping.
+	legacy, err := adapterses.NewIndexer(es, "legacy", adapterses.WithRefresh(adapterses.RefreshWaitFor))
+	require.NoError(t, err)
+	_, err = legacy.Index(ctx, []domain.MessageEvent{{ID: "msg-legacy", Payload: map[string]any{"foo": "bar"}, StatusCode: 200}})
+	require.NoError(t, err)
+	require.ErrorIs(t, legacy.Bootstrap(ctx, adapterses.BootstrapConfig{
+		Name:           "legacy",
+		PayloadMapping: adapterses.PayloadFlattened,
+		Strict:         true,
+	}), adapterses.ErrMappingDrift)
+
+	indexer, err := adapterses.NewIndexer(es, "events-{metadata.tenant}",
+		adapterses.WithRefresh(adapterses.RefreshWaitFor),
+		adapterses.WithDataStream("timestamp"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, indexer.Bootstrap(ctx, adapterses.BootstrapConfig{
+		Name:           "kflow",
+		PayloadMapping: adapterses.PayloadFlattened,
+		Strict:         true,
+	}))
+
+	// The data stream is created from the template on first write, with the
+	// explicit mapping rather than one guessed from the payload.
+	results, err := indexer.Index(ctx, []domain.MessageEvent{{
+		ID:         "msg-ds-1",
+		Payload:    map[string]any{"foo": map[string]any{"nested": true}},
+		Metadata:   map[string]string{"tenant": "acme", "timestamp": "2024-03-09T12:00:00Z"},
+		StatusCode: 200,
+	}})
+	require.NoError(t, err)
+	require.Equal(t, ports.IndexOutcomeSucceeded, results[0].Outcome())
+
+	// Installing again is idempotent and the new backing index matches.
+	require.NoError(t, indexer.Bootstrap(ctx, adapterses.BootstrapConfig{
+		Name:           "kflow",
+		PayloadMapping: adapterses.PayloadFlattened,
+		Strict:         true,
+	}))
+}
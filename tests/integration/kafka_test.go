@@ -4,15 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"regexp"
 	"testing"
 	"time"
 
 	kafkago "github.com/segmentio/kafka-go"
-	kafkamodule "github.com/testcontainers/testcontainers-go/modules/kafka"
 	"github.com/stretchr/testify/require"
+	kafkamodule "github.com/testcontainers/testcontainers-go/modules/kafka"
 
 	adapterskafka "github.com/nimafallahian/go-workflow/internal/adapters/kafka"
 	"github.com/nimafallahian/go-workflow/internal/domain"
+	"github.com/nimafallahian/go-workflow/internal/ports"
 )
 
 var (
@@ -101,9 +103,10 @@ func TestKafkaConsumerReadsMessageEvent(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	consumer, err := adapterskafka.NewConsumer(kafkaBrokers, topic, groupID)
+	consumer, err := adapterskafka.NewConsumer(kafkaBrokers, adapterskafka.Topics(topic), groupID)
 	require.NoError(t, err)
 	defer func() { _ = consumer.Close() }()
+	require.NoError(t, consumer.HealthCheck(ctx))
 
 	msgCh, errCh := consumer.Stream(ctx)
 
@@ -122,3 +125,184 @@ func TestKafkaConsumerReadsMessageEvent(t *testing.T) {
 	}
 }
 
+func TestDeadLetterProducerPublishesWithHeaders(t *testing.T) {
+	if len(kafkaBrokers) == 0 {
+		t.Skip("kafka container not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const topic = "messages-dlq"
+
+	adminConn, err := kafkago.Dial("tcp", kafkaBrokers[0])
+	require.NoError(t, err)
+	err = adminConn.CreateTopics(kafkago.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     1,
+		ReplicationFactor: 1,
+	})
+	require.NoError(t, err)
+	require.NoError(t, adminConn.Close())
+
+	producer, err := adapterskafka.NewDeadLetterProducer(kafkaBrokers, topic)
+	require.NoError(t, err)
+	defer func() { _ = producer.Close() }()
+
+	raw := []byte(`{"id":"msg-4xx","status_code":400}`)
+	err = producer.Publish(ctx, ports.DeadLetter{
+		Value:      raw,
+		Reason:     "invalid data",
+		StatusCode: 400,
+		Topic:      "messages",
+		Partition:  0,
+		Offset:     7,
+		Attempts:   1,
+	})
+	require.NoError(t, err)
+
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers: kafkaBrokers,
+		Topic:   topic,
+	})
+	defer func() { _ = reader.Close() }()
+
+	m, err := reader.ReadMessage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, raw, m.Value)
+
+	headers := make(map[string]string, len(m.Headers))
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	require.Equal(t, "invalid data", headers[adapterskafka.HeaderDLQReason])
+	require.Equal(t, "400", headers[adapterskafka.HeaderDLQStatusCode])
+	require.Equal(t, "messages", headers[adapterskafka.HeaderDLQSourceTopic])
+	require.Equal(t, "0", headers[adapterskafka.HeaderDLQSourcePartition])
+	require.Equal(t, "7", headers[adapterskafka.HeaderDLQSourceOffset])
+	require.Equal(t, "1", headers[adapterskafka.HeaderDLQAttempts])
+}
+
+func TestKafkaConsumerSurfacesPoisonMessagesAndContinues(t *testing.T) {
+	if len(kafkaBrokers) == 0 {
+		t.Skip("kafka container not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const topic = "messages-poison"
+	groupID := "test-group-poison"
+
+	adminConn, err := kafkago.Dial("tcp", kafkaBrokers[0])
+	require.NoError(t, err)
+	err = adminConn.CreateTopics(kafkago.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     1,
+		ReplicationFactor: 1,
+	})
+	require.NoError(t, err)
+	require.NoError(t, adminConn.Close())
+
+	writer := &kafkago.Writer{
+		Addr:         kafkago.TCP(kafkaBrokers...),
+		Topic:        topic,
+		Balancer:     &kafkago.LeastBytes{},
+		RequiredAcks: kafkago.RequireAll,
+	}
+	defer func() { _ = writer.Close() }()
+
+	malformed := []byte(`{"id": "msg-broken", "payload": `)
+	err = writer.WriteMessages(ctx,
+		kafkago.Message{Value: malformed},
+		kafkago.Message{Value: []byte(`{"id":"msg-ok","payload":{},"status_code":200}`)},
+	)
+	require.NoError(t, err)
+
+	consumer, err := adapterskafka.NewConsumer(kafkaBrokers, adapterskafka.Topics(topic), groupID)
+	require.NoError(t, err)
+	defer func() { _ = consumer.Close() }()
+
+	msgCh, errCh := consumer.Stream(ctx)
+
+	for _, check := range []func(ports.KafkaMessage){
+		func(msg ports.KafkaMessage) {
+			require.NotNil(t, msg.Poison)
+			require.Equal(t, malformed, msg.Value)
+		},
+		func(msg ports.KafkaMessage) {
+			require.Nil(t, msg.Poison)
+			require.Equal(t, "msg-ok", msg.Event.ID)
+		},
+	} {
+		select {
+		case msg := <-msgCh:
+			check(msg)
+			require.NoError(t, consumer.Acknowledge(ctx, msg))
+		case err := <-errCh:
+			require.NoError(t, err)
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for message: %v", ctx.Err())
+		}
+	}
+}
+
+func TestKafkaConsumerSubscribesByPattern(t *testing.T) {
+	if len(kafkaBrokers) == 0 {
+		t.Skip("kafka container not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	topics := []string{"pattern.orders", "pattern.payments"}
+	groupID := "test-group-pattern"
+
+	adminConn, err := kafkago.Dial("tcp", kafkaBrokers[0])
+	require.NoError(t, err)
+	for _, topic := range topics {
+		require.NoError(t, adminConn.CreateTopics(kafkago.TopicConfig{
+			Topic:             topic,
+			NumPartitions:     1,
+			ReplicationFactor: 1,
+		}))
+	}
+	require.NoError(t, adminConn.Close())
+
+	writer := &kafkago.Writer{
+		Addr:         kafkago.TCP(kafkaBrokers...),
+		Balancer:     &kafkago.LeastBytes{},
+		RequiredAcks: kafkago.RequireAll,
+	}
+	defer func() { _ = writer.Close() }()
+
+	for _, topic := range topics {
+		value, err := json.Marshal(domain.MessageEvent{ID: "msg-" + topic, StatusCode: 200})
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteMessages(ctx, kafkago.Message{Topic: topic, Value: value}))
+	}
+
+	consumer, err := adapterskafka.NewConsumer(kafkaBrokers,
+		adapterskafka.TopicPattern(regexp.MustCompile(`^pattern\.`), time.Minute), groupID)
+	require.NoError(t, err)
+	defer func() { _ = consumer.Close() }()
+
+	msgCh, errCh := consumer.Stream(ctx)
+
+	// Each message carries the topic it was read from.
+	seen := map[string]string{}
+	for len(seen) < len(topics) {
+		select {
+		case msg := <-msgCh:
+			seen[msg.Topic] = msg.Event.ID
+			require.NoError(t, consumer.Acknowledge(ctx, msg))
+		case err := <-errCh:
+			require.NoError(t, err)
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for messages: %v", ctx.Err())
+		}
+	}
+	for _, topic := range topics {
+		require.Equal(t, "msg-"+topic, seen[topic])
+	}
+}